@@ -0,0 +1,266 @@
+package botmanager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type argKind int
+
+const (
+	//コマンド名の直後に値をそのまま置く
+	argPositional argKind = iota
+	//<Key>=<値> として渡す
+	argNamed
+	//空白区切りの <変数名>=<値> をそれぞれ渡す
+	argVariables
+	//2行目以降の本文として渡す(スラッシュコマンドでは\nで改行できる)
+	argContent
+)
+
+type argType int
+
+const (
+	argString argType = iota
+	//"30m" のような time.ParseDuration の形式
+	argDuration
+)
+
+// ArgSpec はコマンドの引数の定義
+// 引数の解析・エラー・helpの表示・スラッシュコマンドのオプションはこの定義から作る
+type ArgSpec struct {
+	//スラッシュコマンドのオプション名(英小文字)
+	Name        string
+	Description string
+	Required    bool
+	Kind        argKind
+	Type        argType
+	//!gemuboコマンドでのキー(省略時はName)。$から始まる場合は変数として渡す
+	Key      string
+	Choices  []string
+	Complete slashCompletion
+}
+
+func (spec *ArgSpec) key() string {
+	if spec.Key != "" {
+		return spec.Key
+	}
+	return spec.Name
+}
+
+// help に表示する書式
+func (spec *ArgSpec) usage() string {
+	value := "<" + spec.Description + ">"
+	if len(spec.Choices) > 0 {
+		value = strings.Join(spec.Choices, "|")
+	}
+
+	usage := value
+	switch spec.Kind {
+	case argNamed:
+		usage = spec.key() + "=" + value
+	case argVariables:
+		return "(<変数名>=<値>)..."
+	}
+
+	if !spec.Required {
+		usage = "(" + usage + ")"
+	}
+	return usage
+}
+
+func (spec *ArgSpec) validate(value string) error {
+	if len(spec.Choices) > 0 {
+		for _, choice := range spec.Choices {
+			if value == choice {
+				return nil
+			}
+		}
+		return fmt.Errorf("%sには %s のいずれかを指定してください。", spec.key(), strings.Join(spec.Choices, ", "))
+	}
+
+	switch spec.Type {
+	case argDuration:
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return fmt.Errorf("%sは\"30m\"や\"1h30m\"のように指定してください。", spec.key())
+		}
+	}
+	return nil
+}
+
+// 引数を割り当てた結果
+type commandValues struct {
+	//ArgSpec.Name がキー
+	values map[string]string
+	//"$NAME" がキー
+	variables map[string]string
+}
+
+func newCommandValues() *commandValues {
+	return &commandValues{
+		values:    make(map[string]string),
+		variables: make(map[string]string),
+	}
+}
+
+func (cv *commandValues) set(spec *ArgSpec, value string) {
+	if isVariable(spec.key()) {
+		cv.variables[spec.key()] = value
+		return
+	}
+	cv.values[spec.Name] = value
+}
+
+func (command *Command) hasVariables() bool {
+	for _, spec := range command.args {
+		if spec.Kind == argVariables {
+			return true
+		}
+	}
+	return false
+}
+
+func (command *Command) namedArg(key string) (*ArgSpec, bool) {
+	for _, spec := range command.args {
+		if spec.Kind == argNamed && spec.key() == key {
+			return spec, true
+		}
+	}
+	return nil, false
+}
+
+// !gemuboコマンドのトークン(コマンド名より後)と本文を引数に割り当てる
+func (command *Command) bindTokens(tokens []string, content string) (*commandValues, error) {
+	cv := newCommandValues()
+
+	positional := make([]*ArgSpec, 0)
+	for _, spec := range command.args {
+		switch spec.Kind {
+		case argPositional:
+			positional = append(positional, spec)
+		case argContent:
+			if content != "" {
+				cv.set(spec, content)
+			}
+		}
+	}
+
+	for _, token := range tokens {
+		if key, value, found := strings.Cut(token, "="); found {
+			if spec, exist := command.namedArg(key); exist {
+				cv.set(spec, value)
+				continue
+			}
+			if isVariable(key) && command.hasVariables() {
+				cv.variables[key] = value
+				continue
+			}
+			if len(positional) == 0 {
+				return nil, fmt.Errorf("「%s」は%sコマンドの引数ではありません。", key, command.Name)
+			}
+		}
+
+		if len(positional) == 0 {
+			return nil, fmt.Errorf("引数「%s」が多すぎます。", token)
+		}
+		cv.set(positional[0], token)
+		positional = positional[1:]
+	}
+
+	return cv, command.validateValues(cv)
+}
+
+// スラッシュコマンドのオプションを引数に割り当てる
+func (command *Command) bindOptions(options map[string]string) (*commandValues, error) {
+	cv := newCommandValues()
+
+	for _, spec := range command.args {
+		value, exist := options[spec.Name]
+		if !exist || value == "" {
+			continue
+		}
+
+		switch spec.Kind {
+		case argVariables:
+			tokens, _, err := tokenizeCommand(value, false)
+			if err != nil {
+				return nil, err
+			}
+			for _, token := range tokens {
+				key, value, found := strings.Cut(token, "=")
+				if !found || !isVariable(key) {
+					return nil, fmt.Errorf("「%s」は<変数名>=<値>の形式で指定してください。", token)
+				}
+				cv.variables[key] = value
+			}
+		case argContent:
+			cv.set(spec, strings.ReplaceAll(value, `\n`, "\n"))
+		default:
+			cv.set(spec, value)
+		}
+	}
+
+	return cv, command.validateValues(cv)
+}
+
+func (command *Command) validateValues(cv *commandValues) error {
+	for _, spec := range command.args {
+		if spec.Kind == argVariables {
+			continue
+		}
+
+		var value string
+		var exist bool
+		if isVariable(spec.key()) {
+			value, exist = cv.variables[spec.key()]
+		} else {
+			value, exist = cv.values[spec.Name]
+		}
+
+		if !exist {
+			if spec.Required {
+				return errors.New(spec.Description + "が指定されていません。")
+			}
+			continue
+		}
+		if err := spec.validate(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// help <コマンド名> で表示する詳細
+func (command *Command) helpText() string {
+	usage := command.Name
+	for _, spec := range command.args {
+		usage += "\t" + spec.usage()
+	}
+
+	msg := "【コマンド】 " + "\n\t\t**" + usage + "**\n"
+	if len(command.args) > 0 {
+		msg += "【引数】\n"
+		for _, spec := range command.args {
+			line := "\t・" + spec.key()
+			if spec.Kind == argPositional || spec.Kind == argContent || spec.Kind == argVariables {
+				line = "\t・" + spec.Description
+			} else {
+				line += ": " + spec.Description
+			}
+			if spec.Required {
+				line += "(必須)"
+			}
+			msg += line + "\n"
+		}
+	}
+
+	if command.detail != "" {
+		msg += command.detail
+	} else {
+		msg += "【機能】\n" + "\t・" + command.summary + "\n"
+	}
+	return msg
+}
@@ -0,0 +1,148 @@
+package botmanager
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type slashCompletion int
+
+const (
+	completeNone slashCompletion = iota
+	completeCommand
+	completeTemplate
+	completePreset
+	completeBosyuId
+	completeScheduleId
+)
+
+// Discordが受け付ける候補数と表示名の上限
+const (
+	maxAutocompleteChoices   = 25
+	maxAutocompleteChoiceLen = 100
+)
+
+type completionCandidate struct {
+	label string
+	value string
+}
+
+func (manager *BotManager) onAutocomplete(i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	user := i.User
+	if i.Member != nil {
+		user = i.Member.User
+	}
+	command, ok := manager.commands[data.Name]
+	if !ok {
+		return
+	}
+
+	var focused *discordgo.ApplicationCommandInteractionDataOption
+	for _, opt := range data.Options {
+		if opt.Focused {
+			focused = opt
+			break
+		}
+	}
+	if focused == nil {
+		return
+	}
+
+	completion := completeNone
+	for _, spec := range command.args {
+		if spec.Name == focused.Name {
+			completion = spec.Complete
+		}
+	}
+
+	input := strings.ToLower(fmt.Sprint(focused.Value))
+	loc := manager.userLocation(i.GuildID, user.ID)
+	candidates := manager.completionCandidates(completion, i.GuildID, loc)
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+	for _, candidate := range candidates {
+		if len(choices) >= maxAutocompleteChoices {
+			break
+		}
+		if !strings.Contains(strings.ToLower(candidate.label), input) {
+			continue
+		}
+
+		label := candidate.label
+		if runes := []rune(label); len(runes) > maxAutocompleteChoiceLen {
+			label = string(runes[:maxAutocompleteChoiceLen])
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  label,
+			Value: candidate.value,
+		})
+	}
+
+	err := manager.discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		log.Println("Error responding autocomplete\n" + err.Error())
+	}
+}
+
+// loc は候補に表示する時刻のタイムゾーン(候補にはDiscordのタイムスタンプ記法を使えない)
+func (manager *BotManager) completionCandidates(completion slashCompletion, guildId string, loc *time.Location) []*completionCandidate {
+	candidates := make([]*completionCandidate, 0)
+
+	switch completion {
+	case completeCommand:
+		for name := range manager.commands {
+			candidates = append(candidates, &completionCandidate{label: name, value: name})
+		}
+	case completeTemplate:
+		for name := range manager.guildTemplates(guildId) {
+			candidates = append(candidates, &completionCandidate{label: name, value: name})
+		}
+		for name := range manager.guildTemplates(sharedGuildId) {
+			if _, exist := manager.guildTemplates(guildId)[name]; exist {
+				continue
+			}
+			candidates = append(candidates, &completionCandidate{label: name + " (共有)", value: name})
+		}
+	case completePreset:
+		for name := range manager.guildPresets(guildId) {
+			candidates = append(candidates, &completionCandidate{label: name, value: name})
+		}
+	case completeBosyuId:
+		for _, gmsg := range manager.bosyuMsgs {
+			if gmsg.GuildId != guildId {
+				continue
+			}
+			title := gmsg.Title
+			if title == "" {
+				title = fmt.Sprintf("%sがゲムボ！", gmsg.Author.Username)
+			}
+			startTime := gmsg.StartTime.In(loc)
+			label := fmt.Sprintf("%s %s (%s)", gmsg.GemuboId, title, startTime.Format("01/02 15:04"))
+			candidates = append(candidates, &completionCandidate{label: label, value: gmsg.GemuboId})
+		}
+	case completeScheduleId:
+		for _, sch := range manager.schedules {
+			if sch.GuildId != guildId {
+				continue
+			}
+			label := fmt.Sprintf("%s %s (%s %s)", sch.Id, sch.PresetName, sch.Rule, sch.Time)
+			candidates = append(candidates, &completionCandidate{label: label, value: sch.Id})
+		}
+	}
+
+	sort.Slice(candidates, func(a, b int) bool {
+		return candidates[a].label < candidates[b].label
+	})
+	return candidates
+}
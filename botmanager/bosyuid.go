@@ -0,0 +1,81 @@
+package botmanager
+
+import (
+	"gemubobot/gemubo"
+	"gemubobot/lib"
+)
+
+const (
+	//募集IDの文字数(base32で約100万通り)
+	bosyuIdLength = 4
+	//この回数重複したら1文字長くする
+	bosyuIdAttempts = 50
+	//IDの重複を避けるために覚えておく終了した募集の数
+	maxBosyuHistory = 1000
+)
+
+// 募集中・終了済みの募集と重ならないIDを作る
+// ジョブIDなどにも使うので、サーバーごとではなく全体で重ならないようにする
+func (manager *BotManager) newBosyuId() string {
+	length := bosyuIdLength
+	for {
+		for i := 0; i < bosyuIdAttempts; i++ {
+			id := lib.GenerateCode(length)
+			if !manager.bosyuIdUsed(id) {
+				return id
+			}
+		}
+		length++
+	}
+}
+
+func (manager *BotManager) bosyuIdUsed(id string) bool {
+	if _, exist := manager.bosyuMsgs[id]; exist {
+		return true
+	}
+	for _, gmsg := range manager.bosyuHistory {
+		if gmsg.GemuboId == id {
+			return true
+		}
+	}
+	return false
+}
+
+// 終了した募集を履歴に残す(古いものから捨てる)
+func (manager *BotManager) addBosyuHistory(gmsg *gemubo.GemuboMessage) {
+	manager.bosyuHistory = append(manager.bosyuHistory, gmsg)
+	if over := len(manager.bosyuHistory) - maxBosyuHistory; over > 0 {
+		manager.bosyuHistory = manager.bosyuHistory[over:]
+	}
+}
+
+func (manager *BotManager) newScheduleId() string {
+	for {
+		id := lib.GeneRandomID()
+		if _, exist := manager.schedules[id]; !exist {
+			return id
+		}
+	}
+}
+
+// コマンドの対象の募集を募集IDか、返信先の募集メッセージから探す
+// 見つからない場合はユーザー向けのエラーメッセージを返す
+func (manager *BotManager) resolveBosyu(arg *CommandArg, gemuboId string) (*gemubo.GemuboMessage, string) {
+	if gemuboId != "" {
+		gmsg, exist := manager.guildBosyuMsg(arg.m.GuildID, lib.NormalizeCode(gemuboId))
+		if !exist {
+			return nil, "指定されたIDの募集は存在しません"
+		}
+		return gmsg, ""
+	}
+
+	if ref := arg.m.MessageReference; ref != nil && ref.MessageID != "" {
+		gmsg, exist := manager.findBosyuByMessageId(ref.MessageID)
+		if !exist || gmsg.GuildId != arg.m.GuildID {
+			return nil, "返信先のメッセージは募集中の募集ではありません"
+		}
+		return gmsg, ""
+	}
+
+	return nil, "募集IDを指定するか、募集メッセージに返信してコマンドを実行してください"
+}
@@ -1,35 +1,48 @@
 package botmanager
 
 import (
+	"errors"
 	"fmt"
 	"gemubobot/gemubo"
+	"gemubobot/lib"
+	"gemubobot/scheduler"
+	"gemubobot/store"
 	"log"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-var (
-	globalManager *BotManager = nil
-)
+const commandTriger = "!gemubo"
 
 type CommandArg struct {
-	s           *discordgo.Session
-	m           *discordgo.MessageCreate
-	token       []string
+	m     *discordgo.MessageCreate
+	i     *discordgo.InteractionCreate
+	token []string
+	//コマンドの定義(ArgSpec.Name)に従って割り当てた引数
+	values map[string]string
+	//<変数名>=<値> で指定された変数
+	variables   map[string]string
 	originalMsg string
 	commandName string
+	responded   bool
+	//スラッシュコマンドの応答を保留していて、まだ何も返信していない
+	deferred bool
 }
 
-func NewCommandArg(s *discordgo.Session, m *discordgo.MessageCreate, token []string, originalMsg, commandName string) *CommandArg {
+func NewCommandArg(m *discordgo.MessageCreate, token []string, originalMsg, commandName string) *CommandArg {
 	return &CommandArg{
-		s:           s,
 		m:           m,
+		i:           nil,
 		token:       token,
+		values:      make(map[string]string),
+		variables:   make(map[string]string),
 		originalMsg: originalMsg,
 		commandName: commandName,
+		responded:   false,
 	}
 }
 
@@ -38,80 +51,213 @@ type Command struct {
 	handler func(arg *CommandArg, manager *BotManager)
 	summary string
 	detail  string
+	args    []*ArgSpec
+	//メッセージのコマンドとしてだけ使えるようにする(スラッシュコマンドには登録しない)
+	textOnly bool
+}
+
+// 2行目以降を区切らずに本文として受け取るコマンドか
+func (command *Command) takesContent() bool {
+	for _, spec := range command.args {
+		if spec.Kind == argContent {
+			return true
+		}
+	}
+	return false
 }
 
 type BotManager struct {
-	discordSession    *discordgo.Session
-	BotUserInfo       *discordgo.User
-	presets           map[string]*gemubo.Preset
-	templates         map[string]*gemubo.Template
-	bosyuMsgs         map[string]*gemubo.GemuboMessage
-	commands          map[string]*Command
-	batchDurationMinu int
-	lastBatchDate     time.Time
-	nextBatchDate     time.Time
-	OkReaction        string
-	NoReaction        string
-}
-
-func NewBotManager(discordSession *discordgo.Session) *BotManager {
+	discord     DiscordClient
+	store       store.Store
+	BotUserInfo *discordgo.User
+	presets     map[string]map[string]*gemubo.Preset
+	templates   map[string]map[string]*gemubo.Template
+	bosyuMsgs   map[string]*gemubo.GemuboMessage
+	//開始・削除された募集(IDの重複を避けるために残す)
+	bosyuHistory   []*gemubo.GemuboMessage
+	schedules      map[string]*gemubo.Schedule
+	guildTimezones map[string]string
+	userTimezones  map[string]string
+	commands       map[string]*Command
+	scheduler      *scheduler.Scheduler
+	//開始時刻やリマインドの判定に使う現在時刻(テストでは進め方を操作できる)
+	clock      scheduler.Clock
+	OkReaction string
+	NoReaction string
+	//空の場合は未定のリアクションを付けない(GEMUBO_MAYBE_REACTION=none で空になる)
+	MaybeReaction string
+	//trueの場合は開始前のリマインドで未定の人にもメンションする
+	RemindMaybe bool
+	//Discordのイベントとスケジューラのジョブは別々のgoroutineで動くため、
+	//テンプレートや募集などの状態はこのロックを取ってから読み書きする
+	mu sync.Mutex
+	//ロックを外してから行うDiscordへの送信(afterUnlock で積む)
+	pending []func()
+	//受け取ったリアクションのイベントの数(ロックの外でリアクションを取得している間に変わったかを見る)
+	reactionEvents int
+}
+
+// 注入された時計での現在時刻(UTC)
+func (manager *BotManager) now() time.Time {
+	return manager.clock.Now().UTC()
+}
+
+// 状態を扱う処理はこの中で行う(ロック中にもう一度呼ぶとデッドロックする)
+func (manager *BotManager) withLock(fn func()) {
+	for _, send := range manager.runLocked(fn) {
+		send()
+	}
+}
+
+func (manager *BotManager) runLocked(fn func()) []func() {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	fn()
+	pending := manager.pending
+	manager.pending = nil
+	return pending
+}
+
+// ロック中に作ったメッセージの送信をロックを外したあとに回す
+// Discordのレート制限で待たされても他のイベントを止めないため(fn の中では状態を読み書きしない)
+func (manager *BotManager) afterUnlock(fn func()) {
+	manager.pending = append(manager.pending, fn)
+}
+
+// イベントを受け取るには AddHandlers で discordgo.Session に登録する
+func NewBotManager(discord DiscordClient, dataStore store.Store, clock scheduler.Clock) *BotManager {
 	manager := &BotManager{
-		discordSession:    discordSession,
-		BotUserInfo:       nil,
-		presets:           make(map[string]*gemubo.Preset),
-		templates:         make(map[string]*gemubo.Template),
-		bosyuMsgs:         make(map[string]*gemubo.GemuboMessage),
-		batchDurationMinu: 3,
-		lastBatchDate:     time.Now().UTC(),
-		OkReaction:        "👍",
-		NoReaction:        "🙏",
+		discord:        discord,
+		store:          dataStore,
+		BotUserInfo:    nil,
+		presets:        make(map[string]map[string]*gemubo.Preset),
+		templates:      make(map[string]map[string]*gemubo.Template),
+		bosyuMsgs:      make(map[string]*gemubo.GemuboMessage),
+		bosyuHistory:   make([]*gemubo.GemuboMessage, 0),
+		schedules:      make(map[string]*gemubo.Schedule),
+		guildTimezones: make(map[string]string),
+		userTimezones:  make(map[string]string),
+		scheduler:      scheduler.New(clock),
+		clock:          clock,
+		OkReaction:     "👍",
+		NoReaction:     "🙏",
+		MaybeReaction:  "🤔",
 	}
 	manager.setCommands()
-	manager.discordSession.AddHandler(onDiscordMessageCreate)
+	if err := manager.loadState(); err != nil {
+		log.Println("Error loading state\n" + err.Error())
+	}
 	return manager
 }
 
-func SetGlobalManager(manager *BotManager) {
-	globalManager = manager
-}
+// botUser はログインしたBOT自身のユーザー
+func (manager *BotManager) Start(botUser *discordgo.User) {
+	manager.withLock(func() {
+		manager.BotUserInfo = botUser
+	})
+	manager.registerSlashCommands()
 
-func GetGlobalManager() *BotManager {
-	return globalManager
-}
+	//BOTが停止している間に付いたリアクションを反映しておく
+	gemuboIds := make([]string, 0)
+	manager.withLock(func() {
+		for gemuboId := range manager.bosyuMsgs {
+			gemuboIds = append(gemuboIds, gemuboId)
+		}
+	})
+	for _, gemuboId := range gemuboIds {
+		manager.withBosyuReactions(manager.activeBosyu(gemuboId), func(gmsg *gemubo.GemuboMessage) {
+			manager.refreshBosyuEmbed(gmsg)
+		})
+	}
+	manager.withLock(func() {
+		manager.saveState()
+	})
 
-func (manager *BotManager) Start() {
-	manager.BotUserInfo = manager.discordSession.State.User
-	go manager.batchLoop()
+	//BOTが停止している間に開始時刻を過ぎた募集はここですぐに通知される
+	manager.scheduler.Start()
 }
 
 func (manager *BotManager) addGemuboMessage(msg *gemubo.GemuboMessage) {
 	if msg.StartTime != nil {
 		manager.bosyuMsgs[msg.GemuboId] = msg
+		manager.scheduleBosyu(msg)
+	} else {
+		//即時開始の募集はそのまま終了扱いにする
+		manager.addBosyuHistory(msg)
+	}
+}
+
+func (manager *BotManager) scheduleBosyu(msg *gemubo.GemuboMessage) {
+	gemuboId := msg.GemuboId
+	manager.scheduler.Schedule(gemuboId, *msg.StartTime, func() {
+		manager.withBosyuReactions(manager.activeBosyu(gemuboId), manager.onBosyuStart)
+	})
+
+	//過ぎてしまったリマインドや確認は行わない
+	now := manager.now()
+	if msg.MinParticipants > 0 && msg.QuorumCheckOffset > 0 {
+		checkTime := msg.StartTime.Add(-msg.QuorumCheckOffset)
+		if checkTime.After(now) {
+			//開始時刻が変わった場合は確認し直す
+			msg.QuorumChecked = false
+			manager.scheduler.Schedule(quorumJobId(gemuboId), checkTime, func() {
+				manager.withBosyuReactions(manager.activeBosyu(gemuboId), manager.onQuorumCheck)
+			})
+		}
+	}
+	for _, offset := range msg.RemindOffsets {
+		offset := offset
+		remindTime := msg.StartTime.Add(-offset)
+		if remindTime.Before(now) {
+			continue
+		}
+		manager.scheduler.Schedule(remindJobId(gemuboId, offset), remindTime, func() {
+			manager.withBosyuReactions(manager.activeBosyu(gemuboId), func(gmsg *gemubo.GemuboMessage) {
+				manager.onBosyuRemind(gmsg, offset)
+			})
+		})
 	}
 }
 
-func (manager *BotManager) BosyuNotion(gemuboId string) {
+func (manager *BotManager) removeGemuboMessage(gemuboId string) {
 	gmsg, exist := manager.bosyuMsgs[gemuboId]
 	if !exist {
 		return
 	}
 
-	okUsers, err := manager.discordSession.MessageReactions(gmsg.ChannelId, gmsg.MessgeId, manager.OkReaction, 10, "", "")
-	if err != nil {
-		log.Println("Error getting reaction users")
+	delete(manager.bosyuMsgs, gemuboId)
+	manager.addBosyuHistory(gmsg)
+	manager.cancelBosyuJobs(gemuboId, gmsg.RemindOffsets)
+}
+
+// 開始時刻とリマインドの通知を取り消す
+func (manager *BotManager) cancelBosyuJobs(gemuboId string, remindOffsets []time.Duration) {
+	manager.scheduler.Cancel(gemuboId)
+	manager.scheduler.Cancel(quorumJobId(gemuboId))
+	for _, offset := range remindOffsets {
+		manager.scheduler.Cancel(remindJobId(gemuboId, offset))
+	}
+}
+
+func (manager *BotManager) onBosyuStart(gmsg *gemubo.GemuboMessage) {
+	//確認時刻を過ぎてから投稿・変更された場合などはまだ確認されていない
+	//(start_now の場合は確認済みにしてから呼ばれる)
+	if !gmsg.QuorumChecked && !manager.checkQuorum(gmsg) {
 		return
 	}
+
+	gemuboId := gmsg.GemuboId
+	now := manager.now()
+	log.Println("Bosyu started : ", gemuboId, now.Format("2006-01-02 15:04:05 MST"))
+
+	manager.BosyuNotion(gmsg)
+	manager.removeGemuboMessage(gemuboId)
+	manager.saveState()
+}
+
+func (manager *BotManager) BosyuNotion(gmsg *gemubo.GemuboMessage) {
 	fmt.Printf("Notioned Messge: %+v\n", gmsg)
 
-	msgContent := ""
-	msgContent += gmsg.Author.Mention() + " "
-	for _, user := range okUsers {
-		if user.ID == manager.BotUserInfo.ID {
-			continue
-		}
-		msgContent += user.Mention() + " "
-	}
-	msgContent += "\n"
 	msgTitle := "全員しゅうごう～!"
 
 	embed := &discordgo.MessageEmbed{
@@ -122,46 +268,34 @@ func (manager *BotManager) BosyuNotion(gemuboId string) {
 			URL: manager.BotUserInfo.AvatarURL("20"),
 		},
 	}
-	embes := make([]*discordgo.MessageEmbed, 0)
-	embes = append(embes, embed)
-
-	options := &discordgo.MessageSend{
-		Content: msgContent,
-		Reference: &discordgo.MessageReference{
-			MessageID: gmsg.MessgeId,
-		},
-		Embeds: embes,
+	if waitUsers := gmsg.WaitlistParticipants(); len(waitUsers) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   fmt.Sprintf("キャンセル待ち (%d人)", len(waitUsers)),
+			Value:  gemubo.ParticipantsFieldValue(waitUsers),
+			Inline: false,
+		})
 	}
 
-	_, err = manager.discordSession.ChannelMessageSendComplex(gmsg.ChannelId, options)
-	if err != nil {
-		log.Println("Error sending notion message")
-		errmsg := fmt.Sprintf("開始通知の送信に失敗しました\n(ID:%s)", gmsg.GemuboId)
-		manager.SendErrorMessage(gmsg.ChannelId, "", errmsg, nil)
-		return
+	channelId, messageId := gmsg.ChannelId, gmsg.MessgeId
+	contents := splitMentions(participantMentions(gmsg), maxMessageContentLen)
+	//未定の人には控えめに別のメッセージでメンションする
+	maybeContents := make([]string, 0)
+	if mentions := maybeMentions(gmsg); len(mentions) > 0 {
+		mentions = append([]string{"来れたら来てね"}, mentions...)
+		maybeContents = splitMentions(mentions, maxMessageContentLen)
 	}
-}
-
-func (manager *BotManager) batchLoop() {
-	for {
-		dulation := time.Duration(manager.batchDurationMinu) * time.Minute
-		time.Sleep(dulation)
-		now := time.Now().UTC()
-		log.Println("Batch Executed : ", now.Add(9*time.Hour).Format("2006-01-02 15:04:05"))
+	errmsg := fmt.Sprintf("開始通知の送信に失敗しました\n(ID:%s)", gmsg.GemuboId)
 
-		//最終探索時間の更新
-		manager.lastBatchDate = time.Now().UTC()
-		manager.nextBatchDate = manager.lastBatchDate.Add(dulation)
-
-		//招集
-
-		for _, msg := range manager.bosyuMsgs {
-			if msg.StartTime.Before(manager.lastBatchDate) {
-				manager.BosyuNotion(msg.GemuboId)
-				delete(manager.bosyuMsgs, msg.GemuboId)
-			}
+	manager.afterUnlock(func() {
+		if err := manager.replyMentions(channelId, messageId, contents, embed); err != nil {
+			log.Println("Error sending notion message\n" + err.Error())
+			manager.SendErrorMessage(channelId, "", errmsg, nil)
+			return
 		}
-	}
+		if err := manager.replyMentions(channelId, messageId, maybeContents, nil); err != nil {
+			log.Println("Error sending maybe mentions\n" + err.Error())
+		}
+	})
 }
 
 func (manager *BotManager) setCommands() {
@@ -171,61 +305,175 @@ func (manager *BotManager) setCommands() {
 		Name:    "help",
 		handler: onHelpCommand,
 		summary: "コマンド一覧や詳細を表示します",
-		detail:  "【コマンド】 " + "\n\t\t**help\t(コマンド名)**\n" + "【機能】\n" + "\t・コマンドの一覧を表示します\n" + "\t・コマンド名を指定すると詳細を表示します\n",
+		detail:  "【機能】\n" + "\t・コマンドの一覧を表示します\n" + "\t・コマンド名を指定すると詳細を表示します\n",
+		args: []*ArgSpec{
+			{Name: "command", Description: "詳細を表示するコマンド名", Kind: argPositional, Complete: completeCommand},
+		},
 	})
 	commands = append(commands, &Command{
 		Name:    "settempl",
 		handler: onSetTemplateCommand,
 		summary: "テンプレートを登録します",
-		detail:  "【コマンド】 " + "\n\t\t**settempl\tname=<テンプレート名> <テンプレート内容>**\n" + "【機能】\n" + "\t・募集メッセージのテンプレートを登録します\n" + "\t・テンプレート内容は複数行に渡って指定できます\n" + "\t・$で変数を設定できます\n" + "【テンプレート例】\n" + "\tゲーム: $GAMES\n" + "\t人数: $NUM\n" + "\t開始: $START_TIME\n",
+		detail:  "【機能】\n" + "\t・募集メッセージのテンプレートを登録します\n" + "\t・テンプレート内容は複数行に渡って指定できます\n" + "\t・scope=globalを指定すると全サーバー共有のテンプレートとして登録します(上書き・削除は登録したサーバーからのみできます)\n" + "\t・$で変数を設定できます($NAME または ${NAME}、日本語の変数名は${ゲーム}のように{}で囲みます)\n" + "\t・${NAME:-値} で変数が指定されなかった場合の値を設定できます\n" + "\t・${NAME:?} で必須の変数にできます(${NAME:?説明} で説明を付けられます)\n" + "\t・$そのものを書く場合は$$と書いてください\n" + "\t・先頭に---で囲んだヘッダーを書くと変数の型を宣言できます(1行に1つ「$変数名: 型」)\n" + "\t\t型: string / int 1..10 / enum valo|apex|ow / time / url / user / role\n" + "【テンプレート例】\n" + "\tゲーム: $GAMES\n" + "\t人数: $NUM\n" + "\t開始: $START_TIME\n",
+		args: []*ArgSpec{
+			{Name: "name", Description: "テンプレート名", Required: true, Kind: argNamed},
+			{Name: "content", Description: "テンプレート内容(\\nで改行)", Required: true, Kind: argContent},
+			{Name: "scope", Description: "globalで全サーバー共有", Kind: argNamed, Choices: []string{"global"}},
+		},
 	})
 	commands = append(commands, &Command{
 		Name:    "templs",
 		handler: onTemplatesCommand,
 		summary: "テンプレート一覧や詳細を表示します",
-		detail:  "【コマンド】 " + "\n\t\t**templs\t(テンプレート名)**\n" + "【機能】\n" + "\t・テンプレートの一覧を表示します\n" + "\t・テンプレート名を指定すると詳細を表示します\n",
+		detail:  "【機能】\n" + "\t・このサーバーと共有のテンプレートの一覧を表示します\n" + "\t・テンプレート名を指定すると内容と変数の一覧を表示します\n" + "\t・$START_TIME などの特殊変数には「※特殊変数」と表示されます\n",
+		args: []*ArgSpec{
+			{Name: "name", Description: "詳細を表示するテンプレート名", Kind: argPositional, Complete: completeTemplate},
+		},
 	})
 	commands = append(commands, &Command{
 		Name:    "setpreset",
 		handler: onSetPresetCommand,
 		summary: "プリセットを登録します",
-		detail:  "【コマンド】 " + "\n\t\t**setpreset\ttemplname=<テンプレート名>\tpresetname=<プリセット名>\t(<変数名>=<値>)...**\n" + "【機能】\n" + "\t・募集メッセージのプリセット(テンプレートと変数の値のセット)を登録します\n" + "\t・テンプレート名は「!gemubo templs」で確認できます\n" + "\t・変数名はテンプレートの変数名と同じものを指定してください\n" + "\t・変数名は複数指定できます(全ての変数を指定する必要はありません)\n" + "\t・変数の代入値には半角スペースは使えません(全角スペースを使用してください)\n" + "【コマンド例】\n" + "\tsetpreset" + "\ttemplname=templ1" + "\tpresetname=pre1\n" + "\t$GAMES=valo　OW\n" + "\t$NUM=5\n" + "\t$START_TIME=20:00\n",
+		detail:  "【機能】\n" + "\t・募集メッセージのプリセット(テンプレートと変数の値のセット)を登録します\n" + "\t・テンプレート名は「!gemubo templs」で確認できます\n" + "\t・変数名はテンプレートの変数名と同じものを指定してください(テンプレートにない変数は警告されます)\n" + "\t・変数名は複数指定できます(全ての変数を指定する必要はありません)\n" + "\t・2行目以降は1行に1つずつ書くと、値に空白を含められます($GAMES=valo OW)\n" + "\t・1行目に書く場合や改行を含める場合は $GAMES=\"valo OW\" のように\"で囲んでください(\\\" で\"そのものを書けます)\n" + "【コマンド例】\n" + "\tsetpreset" + "\ttemplname=templ1" + "\tpresetname=pre1\n" + "\t$GAMES=\"valo OW\"\n" + "\t$NUM=5\n" + "\t$START_TIME=20:00\n",
+		args: []*ArgSpec{
+			{Name: "templname", Description: "テンプレート名", Required: true, Kind: argNamed, Complete: completeTemplate},
+			{Name: "presetname", Description: "プリセット名", Required: true, Kind: argNamed},
+			{Name: "variables", Description: "空白区切りの<変数名>=<値>", Kind: argVariables},
+		},
 	})
 	commands = append(commands, &Command{
 		Name:    "presets",
 		handler: onPresetsCommand,
 		summary: "プリセット一覧や詳細を表示します",
-		detail:  "【コマンド】 " + "\n\t\t**presets\t(プリセット名)**\n" + "【機能】\n" + "\t・プリセットの一覧を表示します\n" + "\t・プリセット名を指定すると詳細を表示します\n",
+		detail:  "【機能】\n" + "\t・プリセットの一覧を表示します\n" + "\t・プリセット名を指定すると詳細を表示します\n",
+		args: []*ArgSpec{
+			{Name: "name", Description: "詳細を表示するプリセット名", Kind: argPositional, Complete: completePreset},
+		},
 	})
 	commands = append(commands, &Command{
 		Name:    "bosyu",
 		handler: onBosyuCommand,
 		summary: "募集を行います",
-		detail:  "【コマンド】 " + "\n\t\t**bosyu\t<template=<テンプレート名>\t|\tpreset=<プリセット名>>\t(<変数名>=<値>)...**\n" + "【機能】\n" + "\t・テンプレートの変数を代入して募集メッセージを送信します\n" + "\t・テンプレート名かプリセット名はどちらかを必ず指定してください\n" + "\t・変数名はテンプレートの変数名と同じものを指定してください\n" + "\t・変数の代入値には半角スペースは使えません(全角スペースを使用してください)\n" + "\t・$START_TIME変数は特殊であり、時間をhh:mm形式で指定することで開始時刻を設定できます\n" + "\t・$START_TIME変数を指定しないまたは`NOW`を代入することで即時開始となります\n" + "\t・開始時刻時にOKのリアクションを押している人に対して通知を行います\n" + "\t・$IMAGE_URL変数は特殊であり, URLを指定することで任意の画像を添付できます\n" + "\t・$TITLE変数は特殊であり、任意の文字列を募集メッセージのタイトルに設定できます(指定なしの場合はデフォルトのタイトルが使用されます)\n" + "【コマンド例】\n" + "\tbosyu" + "\tpreset=pre1\n" + "\t$NUM=3\n" + "\t$START_TIME=20:30\n",
+		detail:  "【機能】\n" + "\t・テンプレートの変数を代入して募集メッセージを送信します\n" + "\t・テンプレート名かプリセット名はどちらかを必ず指定してください\n" + "\t・変数名はテンプレートの変数名と同じものを指定してください(テンプレートにない変数は警告されます)\n" + "\t・2行目以降は1行に1つずつ書くと、値に空白を含められます($GAMES=valo OW)\n" + "\t・1行目に書く場合や改行を含める場合は $GAMES=\"valo OW\" のように\"で囲んでください(\\\" で\"そのものを書けます)\n" + "\t・$START_TIME変数は特殊であり、開始時刻を設定できます(「!gemubo tz」で設定したタイムゾーンで解釈されます)\n" + "\t\t(例: 20:00 / 20時半 / 10/25 21:00 / 2026-10-25T21:00 / +45m / 1時間30分後 / 明日21時 / 土曜 20:00)\n" + "\t・$START_TIME変数を指定しないまたは`NOW`を代入することで即時開始となります\n" + "\t・開始時刻時にOKのリアクションを押している人に対して通知を行います\n" + "\t・リアクションした人は募集メッセージの参加者欄に表示されます\n" + "\t・未定のリアクションを押した人には開始時刻に「来れたら来てね」と別にメンションします\n" + "\t・$MAX変数は特殊であり、参加人数の上限を設定できます(上限を超えた人はキャンセル待ちになり、空きが出ると繰り上がります)\n" + "\t・$MIN変数は特殊であり、開始時刻にOKの人数が足りない場合は人数不足で中止します(主催者にはDMで30分延長するボタンが届きます)\n" + "\t・$MIN_CHECK変数に30mのように指定すると開始時刻の30分前に人数を確認します\n" + "\t・$REMIND変数は特殊であり、30m,5mのように指定すると開始時刻の30分前と5分前に参加者へリマインドします\n" + "\t・$IMAGE_URL変数は特殊であり, URLを指定することで任意の画像を添付できます\n" + "\t・$TITLE変数は特殊であり、任意の文字列を募集メッセージのタイトルに設定できます(指定なしの場合はデフォルトのタイトルが使用されます)\n" + "【コマンド例】\n" + "\tbosyu" + "\tpreset=pre1\n" + "\t$NUM=3\n" + "\t$START_TIME=20:30\n",
+		args: []*ArgSpec{
+			{Name: "template", Description: "テンプレート名", Kind: argNamed, Complete: completeTemplate},
+			{Name: "preset", Description: "プリセット名", Kind: argNamed, Complete: completePreset},
+			{Name: "start_time", Description: "開始時刻(20:00 / 明日21時 / +45m / 土曜 20:00 / NOW など)", Kind: argNamed, Key: "$START_TIME"},
+			{Name: "title", Description: "募集メッセージのタイトル", Kind: argNamed, Key: "$TITLE"},
+			{Name: "image_url", Description: "添付する画像のURL", Kind: argNamed, Key: "$IMAGE_URL"},
+			{Name: "variables", Description: "空白区切りの<変数名>=<値>", Kind: argVariables},
+		},
 	})
 	commands = append(commands, &Command{
 		Name:    "notions",
 		handler: onNotionsCommand,
 		summary: "募集一覧を表示します",
-		detail:  "【コマンド】 " + "\n\t\t**notions**\n" + "【機能】\n" + "\t・現在募集中の募集一覧を表示します\n",
+		detail:  "【機能】\n" + "\t・このサーバーで現在募集中の募集一覧を表示します\n",
 	})
 	commands = append(commands, &Command{
 		Name:    "remove_notion",
 		handler: onRemoveNotion,
-		summary: "募集を削除します",
-		detail:  "【コマンド】 " + "**\n\t\tremove_notion\t<募集ID>\n**" + "【機能】\n" + "\t・募集IDを指定して募集を削除します\n" + "\t・募集IDは「!gemubo notions」で確認できます\n",
+		summary: "募集を中止します",
+		detail:  "【機能】\n" + "\t・募集IDを指定して募集を中止します\n" + "\t・募集メッセージは中止の表示に変わり、リアクションは外されます\n" + "\t・参加予定だった人には募集メッセージへの返信で中止を通知します(reasonで理由を添えられます)\n" + "\t・募集IDは「!gemubo notions」で確認できます\n" + "\t・募集メッセージに返信して実行する場合は募集IDを省略できます\n" + "【コマンド例】\n" + "\tremove_notion" + "\tK7QX" + "\treason=\"急用のため\"\n",
+		args: []*ArgSpec{
+			{Name: "id", Description: "中止する募集のID", Kind: argPositional, Complete: completeBosyuId},
+			{Name: "reason", Description: "中止の理由", Kind: argNamed},
+		},
+	})
+	commands = append(commands, &Command{
+		Name:    "edit_bosyu",
+		handler: onEditBosyu,
+		summary: "投稿済みの募集の内容を変更します",
+		detail:  "【機能】\n" + "\t・指定した変数の値だけを変更して募集メッセージを作り直します\n" + "\t・$START_TIMEを変更すると開始時刻の通知やリマインドも変更後の時刻に合わせます\n" + "\t・参加者には募集メッセージへの返信で変更を通知します\n" + "\t・募集メッセージに返信して実行する場合は募集IDを省略できます\n" + "\t・変更できるのは募集した人と「サーバー管理」の権限を持つメンバーだけです\n" + "【コマンド例】\n" + "\tedit_bosyu" + "\tK7QX" + "\t$START_TIME=21:30\n",
+		args: []*ArgSpec{
+			{Name: "id", Description: "変更する募集のID", Kind: argPositional, Complete: completeBosyuId},
+			{Name: "start_time", Description: "新しい開始時刻(20:00 / 明日21時 / +45m など)", Kind: argNamed, Key: "$START_TIME"},
+			{Name: "title", Description: "新しいタイトル", Kind: argNamed, Key: "$TITLE"},
+			{Name: "variables", Description: "空白区切りの<変数名>=<値>", Kind: argVariables},
+		},
+	})
+	commands = append(commands, &Command{
+		Name:    "postpone",
+		handler: onPostponeCommand,
+		summary: "募集の開始時刻を遅らせます",
+		detail:  "【機能】\n" + "\t・募集の開始時刻を指定した時間だけ遅らせます\n" + "\t・開始時刻の通知やリマインドも変更後の時刻に合わせます\n" + "\t・参加者には募集メッセージへの返信で新しい開始時刻を通知します\n" + "\t・募集メッセージに返信して実行する場合は募集IDを省略できます\n" + "\t・変更できるのは募集した人と「サーバー管理」の権限を持つメンバーだけです\n" + "【コマンド例】\n" + "\tpostpone" + "\tK7QX" + "\t+15m\n",
+		args: []*ArgSpec{
+			{Name: "id", Description: "遅らせる募集のID", Kind: argPositional, Complete: completeBosyuId},
+			{Name: "delay", Description: "遅らせる時間(例: +15m)", Kind: argPositional, Type: argDuration},
+		},
+	})
+	commands = append(commands, &Command{
+		Name:    "start_now",
+		handler: onStartNowCommand,
+		summary: "募集を今すぐ開始します",
+		detail:  "【機能】\n" + "\t・開始時刻を待たずに参加者へ開始の通知を送ります\n" + "\t・募集メッセージに返信して実行する場合は募集IDを省略できます\n" + "\t・開始できるのは募集した人と「サーバー管理」の権限を持つメンバーだけです\n",
+		args: []*ArgSpec{
+			{Name: "id", Description: "開始する募集のID", Kind: argPositional, Complete: completeBosyuId},
+		},
 	})
 	commands = append(commands, &Command{
 		Name:    "remove_preset",
 		handler: onRemovePreset,
 		summary: "プリセットを削除します",
-		detail:  "【コマンド】 " + "**\n\t\tremove_preset\t<プリセット名>\n**" + "【機能】\n" + "\t・プリセット名を指定してプリセットを削除します\n" + "\t・プリセット名は「!gemubo presets」で確認できます\n",
+		detail:  "【機能】\n" + "\t・プリセット名を指定してプリセットを削除します\n" + "\t・プリセット名は「!gemubo presets」で確認できます\n",
+		args: []*ArgSpec{
+			{Name: "name", Description: "削除するプリセット名", Required: true, Kind: argPositional, Complete: completePreset},
+		},
 	})
 	commands = append(commands, &Command{
 		Name:    "remove_templ",
 		handler: onRemoveTemplate,
 		summary: "テンプレートを削除します",
-		detail:  "【コマンド】 " + "**\n\t\tremove_templ\t<テンプレート名>\n**" + "【機能】\n" + "\t・テンプレート名を指定してテンプレートを削除します\n" + "\t・テンプレート名は「!gemubo templs」で確認できます\n" + "\t・テンプレートを削除するとそれに紐づくプリセットも削除されます\n",
+		detail:  "【機能】\n" + "\t・テンプレート名を指定してテンプレートを削除します\n" + "\t・テンプレート名は「!gemubo templs」で確認できます\n" + "\t・テンプレートを削除するとそれに紐づくプリセットも削除されます\n" + "\t・scope=globalを指定すると共有テンプレートを削除します(登録したサーバーからのみ削除でき、他のサーバーのプリセットが利用している場合は削除できません)\n",
+		args: []*ArgSpec{
+			{Name: "name", Description: "削除するテンプレート名", Required: true, Kind: argPositional, Complete: completeTemplate},
+			{Name: "scope", Description: "globalで共有テンプレートを削除", Kind: argNamed, Choices: []string{"global"}},
+		},
+	})
+	commands = append(commands, &Command{
+		Name:    "schedule",
+		handler: onScheduleCommand,
+		summary: "定期募集を登録します",
+		detail:  "【機能】\n" + "\t・プリセットを使った募集を定期的に自動で投稿します\n" + "\t・コマンドを実行したチャンネルに投稿されます\n" + "\t・ruleには daily(毎日) / weekdays(平日) / weekends(土日) / mon,wed(曜日の指定) を指定できます\n" + "\t・cron形式で指定する場合は2行目以降に rule=cron:<分> <時> <日> <月> <曜日> と指定してください(timeは不要です)\n" + "\t・leadには開始時刻のどれだけ前に募集を投稿するかを指定します(デフォルトは30m)\n" + "【コマンド例】\n" + "\tschedule" + "\tpreset=pre1" + "\trule=weekdays" + "\ttime=22:00" + "\tlead=1h\n",
+		args: []*ArgSpec{
+			{Name: "preset", Description: "プリセット名", Required: true, Kind: argNamed, Complete: completePreset},
+			{Name: "rule", Description: "繰り返しのルール(daily / weekdays / weekends / mon,wed / cron:...)", Required: true, Kind: argNamed},
+			{Name: "time", Description: "開始時刻(21:00 / 21時半)", Kind: argNamed},
+			{Name: "lead", Description: "開始時刻のどれだけ前に投稿するか(例: 30m)", Kind: argNamed, Type: argDuration},
+		},
+	})
+	commands = append(commands, &Command{
+		Name:    "schedules",
+		handler: onSchedulesCommand,
+		summary: "定期募集一覧を表示します",
+		detail:  "【機能】\n" + "\t・このサーバーの定期募集の一覧と次回の開始時刻を表示します\n",
+	})
+	commands = append(commands, &Command{
+		Name:    "remove_schedule",
+		handler: onRemoveSchedule,
+		summary: "定期募集を削除します",
+		detail:  "【機能】\n" + "\t・定期募集IDを指定して定期募集を削除します\n" + "\t・定期募集IDは「!gemubo schedules」で確認できます\n",
+		args: []*ArgSpec{
+			{Name: "id", Description: "削除する定期募集のID", Required: true, Kind: argPositional, Complete: completeScheduleId},
+		},
+	})
+	commands = append(commands, &Command{
+		Name:    "tz",
+		handler: onTimezoneCommand,
+		summary: "自分のタイムゾーンを設定します",
+		detail:  "【機能】\n" + "\t・$START_TIMEなどの時刻を解釈するタイムゾーンを設定します\n" + "\t・タイムゾーン名を省略すると現在の設定を表示します\n" + "\t・resetを指定するとサーバーのタイムゾーンを使用します\n" + "【コマンド例】\n" + "\ttz\tAmerica/Los_Angeles\n",
+		args: []*ArgSpec{
+			{Name: "timezone", Description: "タイムゾーン名(例: Asia/Tokyo) または reset", Kind: argPositional},
+		},
+	})
+	commands = append(commands, &Command{
+		Name:    "guild_tz",
+		handler: onGuildTimezoneCommand,
+		summary: "サーバーのデフォルトのタイムゾーンを設定します",
+		detail:  "【機能】\n" + "\t・個人のタイムゾーンを設定していないメンバーに使われるタイムゾーンを設定します\n" + "\t・タイムゾーン名を省略すると現在の設定を表示します\n" + "\t・設定できるのは「サーバー管理」の権限を持つメンバーだけです\n" + "\t・未設定の場合はAsia/Tokyoになります\n",
+		args: []*ArgSpec{
+			{Name: "timezone", Description: "タイムゾーン名(例: Asia/Tokyo)", Kind: argPositional},
+		},
 	})
 	commands = append(commands, &Command{
 		Name:    "howuse",
@@ -236,6 +484,8 @@ func (manager *BotManager) setCommands() {
 		Name:    "test",
 		handler: onTestCommand,
 		summary: "開発用コマンドです",
+		//返信先にコマンドのメッセージIDを使うのでスラッシュコマンドでは使えない
+		textOnly: true,
 	})
 
 	for _, command := range commands {
@@ -243,52 +493,77 @@ func (manager *BotManager) setCommands() {
 	}
 }
 
-func sendMessage(s *discordgo.Session, channelID, msg string) {
-	_, err := s.ChannelMessageSend(channelID, msg)
+func (manager *BotManager) sendMessage(channelID, msg string) {
+	_, err := manager.discord.ChannelMessageSend(channelID, msg)
 	if err != nil {
 		log.Println("Error sending message")
 	}
 }
 
-func onDiscordMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
+func (manager *BotManager) onDiscordMessageCreate(m *discordgo.MessageCreate) {
 
-	commandTriger := "!gemubo"
 	msg := m.Content
-
-	tokens1 := strings.Split(msg, "\n")
-	tokens := make([]string, 0)
-
-	tokens = append(tokens, strings.Split(tokens1[0], " ")...)
-	for _, token := range tokens1[1:] {
-		tokens = append(tokens, token)
+	if !strings.HasPrefix(msg, commandTriger) {
+		return
 	}
 
-	if commandTriger != tokens[0] {
+	tokens, rest, err := tokenizeCommand(msg, true)
+	if err != nil {
+		errmsg := fmt.Sprintf("コマンドを解釈できませんでした(%s)", err.Error())
+		manager.SendErrorMessage(m.ChannelID, "", errmsg, nil)
 		return
 	}
 
-	manager := GetGlobalManager()
+	if len(tokens) == 0 || commandTriger != tokens[0] {
+		return
+	}
 
 	if len(tokens) < 2 {
-		onInvalidCommand(s, m, manager)
+		onInvalidCommand(m, manager)
+		return
 	}
 
 	commandName := tokens[1]
+	command, ok := manager.commands[commandName]
+	if !ok {
+		fmt.Println("Invalid command: ", commandName)
+		onInvalidCommand(m, manager)
+		return
+	}
 
-	commandArg := NewCommandArg(s, m, tokens, msg, commandName)
+	//本文を受け取るコマンド以外は2行目以降も引数として区切る
+	content := ""
+	if command.takesContent() {
+		content = rest
+	} else {
+		bodyTokens, err := tokenizeBody(rest)
+		if err != nil {
+			errmsg := fmt.Sprintf("コマンドを解釈できませんでした(%s)", err.Error())
+			manager.SendErrorMessage(m.ChannelID, commandName, errmsg, nil)
+			return
+		}
+		tokens = append(tokens, bodyTokens...)
+	}
+
+	commandArg := NewCommandArg(m, tokens, msg, commandName)
+	cv, err := command.bindTokens(tokens[2:], content)
+	if err != nil {
+		manager.replyError(commandArg, commandName, err.Error(), nil)
+		return
+	}
+	commandArg.values = cv.values
+	commandArg.variables = cv.variables
 
 	//コマンドの実行
-	if command, ok := manager.commands[commandName]; ok {
-		log.Printf("Execute command: %s", commandName)
+	log.Printf("Execute command: %s", commandName)
+	manager.withLock(func() {
 		command.handler(commandArg, manager)
-	} else {
-		fmt.Println("Invalid command: ", commandName)
-		onInvalidCommand(s, m, manager)
-	}
+	})
 }
 
 func onHelpCommand(arg *CommandArg, manager *BotManager) {
-	if len(arg.token) < 3 {
+	commandName, exist := arg.values["command"]
+	if !exist {
 		keys := make([]string, 0, len(manager.commands))
 		for key := range manager.commands {
 			keys = append(keys, key)
@@ -301,79 +576,122 @@ func onHelpCommand(arg *CommandArg, manager *BotManager) {
 			msg += fmt.Sprintf("**%s**\n\tー\t%s\n", command.Name, command.summary)
 		}
 		msg += "各コマンドの詳細は「!gemubo help <コマンド名>」で確認できます\n"
-		sendMessage(arg.s, arg.m.ChannelID, msg)
+		msg += "各コマンドは「/<コマンド名>」のスラッシュコマンドでも実行できます\n"
+		manager.replyText(arg, msg)
 		return
 	}
 
-	commandName := arg.token[2]
 	command, exist := manager.commands[commandName]
 	if !exist {
 		errmsg := "指定されたコマンドは存在しません"
 		title := arg.commandName
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+		manager.replyError(arg, title, errmsg, nil)
 		return
 	}
 
-	msg := command.detail
-	sendMessage(arg.s, arg.m.ChannelID, msg)
+	msg := command.helpText()
+	manager.replyText(arg, msg)
 }
 
 func onSetTemplateCommand(arg *CommandArg, manager *BotManager) {
-	contentStardIdx := 3
-	params := paramParse(arg.token[2:])
-
-	templateName, exist := params["name"]
-	if !exist {
-		titiel := arg.commandName
-		errmsg := "テンプレート名が指定されていません。"
-		manager.SendErrorMessage(arg.m.ChannelID, titiel, errmsg, nil)
-		return
-	}
+	params := arg.values
+	templateName := params["name"]
 
 	content := ""
-	for _, token := range arg.token[contentStardIdx:] {
-		if token != "" {
-			content += token + "\n"
+	for _, line := range strings.Split(params["content"], "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line != "" {
+			content += line + "\n"
 		}
 	}
 
 	if content == "" {
 		title := arg.commandName
 		errmsg := "テンプレート内容が指定されていません。"
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+		manager.replyError(arg, title, errmsg, nil)
 		return
 	}
 
+	guildId := arg.m.GuildID
+	if isSharedScope(params) {
+		guildId = sharedGuildId
+	}
+
 	content = strings.TrimLeft(content, "\n")
-	template := gemubo.NewTemplate(templateName, content)
-	manager.templates[templateName] = template
+	if _, err := gemubo.ParseTemplate(content); err != nil {
+		title := arg.commandName
+		errmsg := fmt.Sprintf("テンプレートの書き方が不正です(%s)", err.Error())
+		manager.replyError(arg, title, errmsg, nil)
+		return
+	}
+	template, exist := manager.guildTemplates(guildId)[templateName]
+	if exist && !canModifyTemplate(template, arg.m.GuildID) {
+		title := arg.commandName
+		errmsg := fmt.Sprintf("共有テンプレート「%s」は他のサーバーが登録したものなので上書きできません", templateName)
+		manager.replyError(arg, title, errmsg, nil)
+		return
+	}
+	if exist {
+		//プリセットが同じテンプレートを参照し続けるように内容だけ書き換える
+		template.Content = content
+	} else {
+		template = gemubo.NewTemplate(guildId, templateName, content)
+		manager.guildTemplates(guildId)[templateName] = template
+	}
+	if guildId == sharedGuildId {
+		template.OwnerGuildId = arg.m.GuildID
+	}
+	manager.saveState()
 	fmt.Println("Set template: ", templateName)
 	msg := fmt.Sprintf("テンプレート「%s」を登録しました。", templateName)
-	manager.SendNormalMessage(arg.m.ChannelID, "", msg, nil)
+	if guildId == sharedGuildId {
+		msg = fmt.Sprintf("共有テンプレート「%s」を登録しました。", templateName)
+	}
+	if vars, err := template.Variables(); err == nil && len(vars) > 0 {
+		msg += "\n変数:\n" + templateVariablesText(vars)
+	}
+	if bareNames := gemubo.BareNonASCIIVariables(content); len(bareNames) > 0 {
+		msg += "\n注意: 日本語の変数名は{}で囲まないと変数になりません\n"
+		for _, name := range bareNames {
+			msg += fmt.Sprintf("\t・$%s → ${%s}\n", name, name)
+		}
+	}
+	manager.replyNormal(arg, "", msg, nil)
 }
 
 func onTemplatesCommand(arg *CommandArg, manager *BotManager) {
-	if len(arg.token) < 3 {
+	templateName, exist := arg.values["name"]
+	if !exist {
 		content := ""
-		for _, template := range manager.templates {
+		for _, template := range manager.guildTemplates(arg.m.GuildID) {
 			content += fmt.Sprintf("-\t%s\n", template.Name)
 		}
+		sharedContent := ""
+		for _, template := range manager.guildTemplates(sharedGuildId) {
+			sharedContent += fmt.Sprintf("-\t%s\n", template.Name)
+		}
 		fields := make([]*discordgo.MessageEmbedField, 0)
 		fields = append(fields, &discordgo.MessageEmbedField{
 			Name:   "テンプレート一覧",
 			Value:  content,
 			Inline: false,
 		})
-		manager.SendNormalMessage(arg.m.ChannelID, "", "", fields)
+		if sharedContent != "" {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:   "共有テンプレート一覧",
+				Value:  sharedContent,
+				Inline: false,
+			})
+		}
+		manager.replyNormal(arg, "", "", fields)
 		return
 	}
 
-	templateName := arg.token[2]
-	template, exist := manager.templates[templateName]
+	template, exist := manager.findTemplate(arg.m.GuildID, templateName)
 	if !exist {
 		title := arg.commandName
 		errmsg := "テンプレートが存在しません。"
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+		manager.replyError(arg, title, errmsg, nil)
 		return
 	}
 
@@ -388,56 +706,47 @@ func onTemplatesCommand(arg *CommandArg, manager *BotManager) {
 		Value:  template.Content + "\n",
 		Inline: true,
 	})
-	manager.SendNormalMessage(arg.m.ChannelID, "", "", fileds)
+	if vars, err := template.Variables(); err == nil && len(vars) > 0 {
+		fileds = append(fileds, &discordgo.MessageEmbedField{
+			Name:   "テンプレート変数",
+			Value:  templateVariablesText(vars),
+			Inline: false,
+		})
+	}
+	manager.replyNormal(arg, "", "", fileds)
 }
 
 func onSetPresetCommand(arg *CommandArg, manager *BotManager) {
-	params := paramParse(arg.token[2:])
-
-	templateName, exist := params["templname"]
-	if !exist {
-		title := arg.commandName
-		errmsg := "テンプレート名が指定されていません。"
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
-		return
-	}
+	templateName := arg.values["templname"]
+	presetName := arg.values["presetname"]
+	msgParams := arg.variables
 
-	presetName, exist := params["presetname"]
-	if !exist {
-		errmsg := "プリセット名が指定されていません。"
-		title := arg.commandName
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
-		return
-	}
-
-	msgParams := make(map[string]string)
-	for pname, value := range params {
-		if isVariable(pname) {
-			msgParams[pname] = value
-		}
-	}
-
-	template, exist := manager.templates[templateName]
+	template, exist := manager.findTemplate(arg.m.GuildID, templateName)
 	if !exist {
 		errmsg := "テンプレートが存在しません。"
 		title := arg.commandName
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+		manager.replyError(arg, title, errmsg, nil)
 		return
 	}
 
-	preset := gemubo.NewPreset(presetName, template, msgParams)
-	manager.presets[presetName] = preset
+	preset := gemubo.NewPreset(arg.m.GuildID, presetName, template, msgParams)
+	manager.guildPresets(arg.m.GuildID)[presetName] = preset
+	manager.saveState()
 
 	msg := fmt.Sprintf("プリセット「%s」を登録しました。", presetName)
 	log.Println(msg)
-	manager.SendNormalMessage(arg.m.ChannelID, "", msg, nil)
+	if warning := variableWarningText(preset.CheckParams(nil)); warning != "" {
+		msg += "\n" + warning
+	}
+	manager.replyNormal(arg, "", msg, nil)
 
 }
 
 func onPresetsCommand(arg *CommandArg, manager *BotManager) {
-	if len(arg.token) < 3 {
+	presetName, exist := arg.values["name"]
+	if !exist {
 		content := ""
-		for _, preset := range manager.presets {
+		for _, preset := range manager.guildPresets(arg.m.GuildID) {
 			content += fmt.Sprintf("-\t%s\n", preset.Name)
 		}
 		fields := make([]*discordgo.MessageEmbedField, 0)
@@ -446,16 +755,15 @@ func onPresetsCommand(arg *CommandArg, manager *BotManager) {
 			Value:  content,
 			Inline: false,
 		})
-		manager.SendNormalMessage(arg.m.ChannelID, "", "", fields)
+		manager.replyNormal(arg, "", "", fields)
 		return
 	}
 
-	presetName := arg.token[2]
-	preset, exist := manager.presets[presetName]
+	preset, exist := manager.guildPresets(arg.m.GuildID)[presetName]
 	if !exist {
 		title := arg.commandName
 		errmsg := "プリセットが存在しません。"
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+		manager.replyError(arg, title, errmsg, nil)
 		return
 	}
 
@@ -479,67 +787,119 @@ func onPresetsCommand(arg *CommandArg, manager *BotManager) {
 		Value:  msg + "\n",
 		Inline: true,
 	})
-	manager.SendNormalMessage(arg.m.ChannelID, "", "", fileds)
+	manager.replyNormal(arg, "", "", fileds)
+}
+
+// テンプレート変数の一覧を表示用の文章にする
+func templateVariablesText(vars []*gemubo.TemplateVariable) string {
+	msg := ""
+	for _, v := range vars {
+		msg += "-\t" + v.Name
+		if v.Type != nil {
+			msg += ": " + v.Type.String()
+		}
+		switch {
+		case v.Required:
+			msg += "\t(必須)"
+		case v.HasDefault:
+			msg += fmt.Sprintf("\t(デフォルト: %s)", v.Default)
+		}
+		if gemubo.IsSpecialVariable(v.Name) {
+			msg += "\t※特殊変数"
+		}
+		msg += "\n"
+	}
+	return msg
+}
+
+// テンプレートにない変数と値のない変数についての注意(問題がなければ空文字)
+func variableWarningText(unknown []string, unfilled []string) string {
+	msg := ""
+	if len(unknown) > 0 {
+		msg += "テンプレートにない変数が指定されています(無視されます): " + strings.Join(unknown, ", ") + "\n"
+	}
+	if len(unfilled) > 0 {
+		msg += "値が指定されていない変数があります(空欄になります): " + strings.Join(unfilled, ", ") + "\n"
+	}
+	return msg
+}
+
+// 募集メッセージを作れなかった理由をユーザー向けの文章にする
+func makeMessageErrorText(err error) string {
+	var invalid *gemubo.ValidationError
+	if errors.As(err, &invalid) {
+		return "以下の変数の値が不正です"
+	}
+	var missing *gemubo.MissingVariablesError
+	if errors.As(err, &missing) {
+		msg := "以下の変数を指定してください"
+		for idx, name := range missing.Names {
+			msg += "\n\t・$" + name
+			if missing.Messages[idx] != "" {
+				msg += " (" + missing.Messages[idx] + ")"
+			}
+		}
+		return msg
+	}
+	return fmt.Sprintf("不正な値が指定されています(%s)", err.Error())
+}
+
+// 変数の値が不正な場合は変数ごとのフィールドにする(それ以外のエラーはnil)
+func makeMessageErrorFields(err error) []*discordgo.MessageEmbedField {
+	var invalid *gemubo.ValidationError
+	if !errors.As(err, &invalid) {
+		return nil
+	}
+	fields := make([]*discordgo.MessageEmbedField, 0)
+	for _, problem := range invalid.Problems {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   problem.Name,
+			Value:  fmt.Sprintf("「%s」\n%s", problem.Value, problem.Message),
+			Inline: false,
+		})
+	}
+	return fields
 }
 
 func onBosyuCommand(arg *CommandArg, manager *BotManager) {
-	params := paramParse(arg.token[2:])
+	params := arg.values
 	presetName, exist := params["preset"]
-	OkReaction := manager.OkReaction
-	NoReaction := manager.NoReaction
 	author := arg.m.Author
 
 	//プリセットが指定されている場合
 	if exist {
-		preset, exist := manager.presets[presetName]
+		preset, exist := manager.guildPresets(arg.m.GuildID)[presetName]
 		if !exist {
 			title := arg.commandName
 			errmsg := "プリセットが存在しません。"
-			manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+			manager.replyError(arg, title, errmsg, nil)
 			return
 		}
 
-		additonalParam := make(map[string]string)
-		for pname, value := range params {
-			if isVariable(pname) {
-				additonalParam[pname] = value
-			}
-		}
+		additonalParam := arg.variables
 
-		gemuboMsg, err := preset.MakeMessage(additonalParam, arg.m.ChannelID, arg.m.GuildID, author)
+		loc := manager.userLocation(arg.m.GuildID, author.ID)
+		gemuboMsg, err := preset.MakeMessage(additonalParam, arg.m.ChannelID, arg.m.GuildID, author, manager.now(), loc)
 		if err != nil {
 			title := arg.commandName
-			errmsg := fmt.Sprintf("不正な値が指定されています(%s)", err.Error())
-			manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+			errmsg := makeMessageErrorText(err)
+			manager.replyError(arg, title, errmsg, makeMessageErrorFields(err))
 			return
 		}
 
-		embed := gemubo.MakeEmbedBosyuMessage(gemuboMsg)
-		embeds := make([]*discordgo.MessageEmbed, 0)
-		embeds = append(embeds, embed)
-
-		content := "@everyone\n"
-		msgObj := &discordgo.MessageSend{
-			Content: content,
-			Embeds:  embeds,
+		if warning := variableWarningText(preset.CheckParams(additonalParam)); warning != "" {
+			manager.replyNormal(arg, "注意", warning, nil)
 		}
 
-		dmsg, err := arg.s.ChannelMessageSendComplex(arg.m.ChannelID, msgObj)
-
+		err = manager.postBosyu(gemuboMsg, "@everyone\n")
 		if err != nil {
 			log.Println("Error sending embed message")
 			title := arg.commandName
 			errmsg := fmt.Sprintf("メッセージの送信に失敗しました。\n(ID:%s)", gemuboMsg.GemuboId)
-			manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+			manager.replyError(arg, title, errmsg, nil)
 			return
 		}
 
-		gemuboMsg.MessgeId = dmsg.ID
-		manager.addGemuboMessage(gemuboMsg)
-
-		arg.s.MessageReactionAdd(arg.m.ChannelID, dmsg.ID, OkReaction)
-		arg.s.MessageReactionAdd(arg.m.ChannelID, dmsg.ID, NoReaction)
-
 		return
 	}
 
@@ -548,144 +908,200 @@ func onBosyuCommand(arg *CommandArg, manager *BotManager) {
 	if !exist {
 		title := arg.commandName
 		errmsg := "テンプレート名またはプリセット名が指定されていません。"
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+		manager.replyError(arg, title, errmsg, nil)
 		return
 	}
 
-	template, exist := manager.templates[templateName]
+	template, exist := manager.findTemplate(arg.m.GuildID, templateName)
 	if !exist {
 
 		errmsg := "テンプレートが存在しません。"
 		title := arg.commandName
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+		manager.replyError(arg, title, errmsg, nil)
 		return
 	} else {
-		msgParams := make(map[string]string)
-		for pname, value := range params {
-			if isVariable(pname) {
-				msgParams[pname] = value
-			}
-		}
+		msgParams := arg.variables
 
-		preset := gemubo.NewPreset(templateName, template, msgParams)
+		preset := gemubo.NewPreset(arg.m.GuildID, templateName, template, msgParams)
 
-		gemuboMsg, err := preset.MakeMessage(nil, arg.m.ChannelID, arg.m.GuildID, author)
+		loc := manager.userLocation(arg.m.GuildID, author.ID)
+		gemuboMsg, err := preset.MakeMessage(nil, arg.m.ChannelID, arg.m.GuildID, author, manager.now(), loc)
 		if err != nil {
-			errmsg := fmt.Sprintf("不正な値が指定されています(%s)", err.Error())
+			errmsg := makeMessageErrorText(err)
 			title := arg.commandName
-			manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+			manager.replyError(arg, title, errmsg, makeMessageErrorFields(err))
 			return
 		}
 
-		embed := gemubo.MakeEmbedBosyuMessage(gemuboMsg)
-		dmsg, err := arg.s.ChannelMessageSendEmbed(arg.m.ChannelID, embed)
+		if warning := variableWarningText(preset.CheckParams(nil)); warning != "" {
+			manager.replyNormal(arg, "注意", warning, nil)
+		}
 
+		err = manager.postBosyu(gemuboMsg, "")
 		if err != nil {
 			fmt.Println("Error sending embed message")
 			errmsg := fmt.Sprintf("メッセージの送信に失敗しました\n(ID:%s)", gemuboMsg.GemuboId)
 			title := arg.commandName
-			manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+			manager.replyError(arg, title, errmsg, nil)
 			return
 		}
 
-		gemuboMsg.MessgeId = dmsg.ID
-		manager.addGemuboMessage(gemuboMsg)
+		return
+	}
+
+}
 
-		arg.s.MessageReactionAdd(arg.m.ChannelID, dmsg.ID, OkReaction)
-		arg.s.MessageReactionAdd(arg.m.ChannelID, dmsg.ID, NoReaction)
+// 募集メッセージを投稿して開始時刻の通知を登録する
+func (manager *BotManager) postBosyu(gemuboMsg *gemubo.GemuboMessage, content string) error {
+	gemuboMsg.GemuboId = manager.newBosyuId()
+	embed := gemubo.MakeEmbedBosyuMessage(gemuboMsg)
+	msgObj := &discordgo.MessageSend{
+		Content: content,
+		Embeds:  []*discordgo.MessageEmbed{embed},
+	}
 
-		return
+	dmsg, err := manager.discord.ChannelMessageSendComplex(gemuboMsg.ChannelId, msgObj)
+	if err != nil {
+		return err
 	}
 
+	gemuboMsg.MessgeId = dmsg.ID
+	manager.addGemuboMessage(gemuboMsg)
+	manager.saveState()
+
+	channelId := gemuboMsg.ChannelId
+	manager.afterUnlock(func() {
+		for _, emoji := range []string{manager.OkReaction, manager.NoReaction, manager.MaybeReaction} {
+			if emoji != "" {
+				manager.discord.MessageReactionAdd(channelId, dmsg.ID, emoji)
+			}
+		}
+	})
+	return nil
 }
 
 func onNotionsCommand(arg *CommandArg, manager *BotManager) {
 	msg := ""
 	for _, gmsg := range manager.bosyuMsgs {
+		if gmsg.GuildId != arg.m.GuildID {
+			continue
+		}
 		messageLink := ""
 		messageLink = fmt.Sprintf("https://discord.com/channels/%s/%s/%s", gmsg.GuildId, gmsg.ChannelId, gmsg.MessgeId)
 
 		msg += fmt.Sprintf("-\tID: %s ([Content](<%s>))\n", gmsg.GemuboId, messageLink)
-		startJPTime := gmsg.StartTime.Add(time.Hour * 9)
-		msg += fmt.Sprintf("\t\t\t開始時刻:%s\n", startJPTime.Format("2006-01-02 15:04:05"))
+		msg += fmt.Sprintf("\t\t\t開始時刻:%s (%s)\n", lib.DiscordTimestamp(*gmsg.StartTime, "F"), lib.DiscordTimestamp(*gmsg.StartTime, "R"))
+
+		remindTimes := make([]string, 0)
+		for _, offset := range gmsg.RemindOffsets {
+			if remindTime, exist := manager.scheduler.Scheduled(remindJobId(gmsg.GemuboId, offset)); exist {
+				remindTimes = append(remindTimes, lib.DiscordTimestamp(remindTime, "t"))
+			}
+		}
+		if len(remindTimes) > 0 {
+			msg += fmt.Sprintf("\t\t\tリマインド:%s\n", strings.Join(remindTimes, ", "))
+		}
 	}
 	title := "募集一覧"
-	manager.SendNormalMessage(arg.m.ChannelID, title, msg, nil)
+	manager.replyNormal(arg, title, msg, nil)
 }
 
 func onRemoveNotion(arg *CommandArg, manager *BotManager) {
-	if len(arg.token) < 3 {
-		errmsg := "削除する募集のIDが指定されていません"
+	gmsg, errmsg := manager.resolveBosyu(arg, arg.values["id"])
+	if gmsg == nil {
 		title := arg.commandName
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+		manager.replyError(arg, title, errmsg, nil)
 		return
 	}
 
-	gemuboId := arg.token[2]
-	_, exist := manager.bosyuMsgs[gemuboId]
-	if !exist {
-		errmsg := "指定されたIDの募集は存在しません"
-		title := arg.commandName
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
-		return
-	}
+	gemuboId := gmsg.GemuboId
+	gmsg.Canceled = true
+	gmsg.CancelReason = arg.values["reason"]
+	manager.removeGemuboMessage(gemuboId)
+	manager.saveState()
+
+	manager.refreshBosyuEmbed(gmsg)
+	//中止後に参加状況が変わらないようにリアクションを外す
+	channelId, messageId := gmsg.ChannelId, gmsg.MessgeId
+	manager.afterUnlock(func() {
+		if err := manager.discord.MessageReactionsRemoveAll(channelId, messageId); err != nil {
+			log.Println("Error removing reactions\n" + err.Error())
+		}
+	})
+	manager.notifyCanceled(gmsg, fmt.Sprintf("募集(ID:%s)は中止になりました", gemuboId))
 
-	delete(manager.bosyuMsgs, gemuboId)
-	msg := fmt.Sprintf("ID:%sの募集を削除しました", gemuboId)
-	manager.SendNormalMessage(arg.m.ChannelID, "", msg, nil)
+	msg := fmt.Sprintf("ID:%sの募集を中止しました", gemuboId)
+	manager.replyNormal(arg, "", msg, nil)
 }
 
 func onRemovePreset(arg *CommandArg, manager *BotManager) {
-	if len(arg.token) < 3 {
-		errmsg := "削除するプリセットの名前が指定されていません"
-		title := arg.commandName
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
-		return
-	}
-
-	presetName := arg.token[2]
-	_, exist := manager.presets[presetName]
+	presetName := arg.values["name"]
+	presets := manager.guildPresets(arg.m.GuildID)
+	_, exist := presets[presetName]
 	if !exist {
 		errmsg := "指定された名前のプリセットは存在しません"
 		title := arg.commandName
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+		manager.replyError(arg, title, errmsg, nil)
 		return
 	}
 
-	delete(manager.presets, presetName)
+	delete(presets, presetName)
+	manager.saveState()
 	msg := fmt.Sprintf("プリセット:%sを削除しました", presetName)
-	manager.SendNormalMessage(arg.m.ChannelID, "", msg, nil)
+	manager.replyNormal(arg, "", msg, nil)
 }
 
 func onRemoveTemplate(arg *CommandArg, manager *BotManager) {
-	if len(arg.token) < 3 {
-		errmsg := "削除するテンプレートの名前が指定されていません"
-		title := arg.commandName
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
-		return
+	templateName := arg.values["name"]
+	guildId := arg.m.GuildID
+	if isSharedScope(arg.values) {
+		guildId = sharedGuildId
 	}
 
-	templateName := arg.token[2]
-	_, exist := manager.templates[templateName]
+	templates := manager.guildTemplates(guildId)
+	template, exist := templates[templateName]
 	if !exist {
 		errmsg := "指定された名前のテンプレートは存在しません"
 		title := arg.commandName
-		manager.SendErrorMessage(arg.m.ChannelID, title, errmsg, nil)
+		manager.replyError(arg, title, errmsg, nil)
+		return
+	}
+
+	if !canModifyTemplate(template, arg.m.GuildID) {
+		errmsg := fmt.Sprintf("共有テンプレート「%s」は他のサーバーが登録したものなので削除できません", templateName)
+		title := arg.commandName
+		manager.replyError(arg, title, errmsg, nil)
 		return
 	}
 
+	//共有テンプレートは他のサーバーのプリセットからも参照されているので、その場合は削除しない
 	presetNames := make([]string, 0)
-	for _, preset := range manager.presets {
-		if preset.Template.Name == templateName {
-			presetNames = append(presetNames, preset.Name)
+	otherGuilds := 0
+	for presetGuildId, presets := range manager.presets {
+		for _, preset := range presets {
+			if preset.Template != template {
+				continue
+			}
+			if presetGuildId == arg.m.GuildID {
+				presetNames = append(presetNames, preset.Name)
+			} else {
+				otherGuilds++
+			}
 		}
 	}
+	if otherGuilds > 0 {
+		errmsg := fmt.Sprintf("他のサーバーのプリセット(%d件)が利用しているため削除できません", otherGuilds)
+		title := arg.commandName
+		manager.replyError(arg, title, errmsg, nil)
+		return
+	}
 
+	presets := manager.guildPresets(arg.m.GuildID)
 	for _, presetName := range presetNames {
-		delete(manager.presets, presetName)
+		delete(presets, presetName)
 	}
-
-	delete(manager.templates, templateName)
+	delete(templates, templateName)
+	manager.saveState()
 
 	msg := fmt.Sprintf("テンプレート:%sを削除しました\n", templateName)
 	if len(presetNames) > 0 {
@@ -695,7 +1111,7 @@ func onRemoveTemplate(arg *CommandArg, manager *BotManager) {
 		}
 	}
 
-	manager.SendNormalMessage(arg.m.ChannelID, "", msg, nil)
+	manager.replyNormal(arg, "", msg, nil)
 }
 
 func onHowUseCommand(arg *CommandArg, manager *BotManager) {
@@ -710,16 +1126,16 @@ func onHowUseCommand(arg *CommandArg, manager *BotManager) {
 	msg += "\t・次に、bosyu コマンドを利用して募集を投稿する\n"
 	msg += "\t・この時に、変数に値を代入して募集の投稿文を完成させる\n"
 	msg += "\n\t変数の代入例:\n" + "\t\tbosyu template=テンプレート名\n" + "\t\t$GAMES=VALORANT\n" + "\t\t$NUM=5\n" + "\t\t$START_TIME=20:00\n"
-	msg += "\n\t・$START_TIME変数は特殊であり、時間をhh:mm形式で指定することで開始時刻を設定できる\n"
+	msg += "\n\t・$START_TIME変数は特殊であり、20:00 / 明日21時 / +45m のように指定することで開始時刻を設定できる\n"
 
 	msg += "\n**【プリセットの登録】**\n"
 	msg += "\t・毎回すべての変数を指定するのは面倒なため、あらかじめ変数の代入値も指定したプリセットをつくることができる\n"
 	msg += "\t・setpreset コマンドを利用してプリセットを登録する\n"
 	msg += "\n\tコマンド例:\n" + "\t\tsetpreset\ttemplname=テンプレート名\tpresetname=プリセット名\n" + "\t\t$GAMES=VALORANT\n" + "\t\t$NUM=5\n" + "\t\t$START_TIME=20:00\n"
-	sendMessage(arg.s, arg.m.ChannelID, msg)
+	manager.replyText(arg, msg)
 }
 
-func onInvalidCommand(s *discordgo.Session, m *discordgo.MessageCreate, manager *BotManager) {
+func onInvalidCommand(m *discordgo.MessageCreate, manager *BotManager) {
 	msg := "不正なコマンドです。コマンド一覧は「!gemubo help」で確認できます。"
 	manager.SendErrorMessage(m.ChannelID, "", msg, nil)
 }
@@ -746,25 +1162,14 @@ func onTestCommand(arg *CommandArg, manager *BotManager) {
 		Embeds: embeds,
 	}
 
-	arg.s.ChannelMessageSendComplex(arg.m.ChannelID, options)
+	manager.discord.ChannelMessageSendComplex(arg.m.ChannelID, options)
 }
 
-func paramParse(tokens []string) map[string]string {
-	params := make(map[string]string)
-	for _, token := range tokens {
-		if strings.Contains(token, "=") {
-			param := strings.Split(token, "=")
-			params[param[0]] = param[1]
-		}
-	}
-	return params
-}
-
-func (manager *BotManager) SendNormalMessage(channelId string, title string, msg string, fileds []*discordgo.MessageEmbedField) {
+func (manager *BotManager) makeEmbed(title string, msg string, color int, fileds []*discordgo.MessageEmbedField) *discordgo.MessageEmbed {
 	embed := &discordgo.MessageEmbed{
 		Title:       title,
 		Description: msg,
-		Color:       0x00ff00,
+		Color:       color,
 		Thumbnail: &discordgo.MessageEmbedThumbnail{
 			URL: manager.BotUserInfo.AvatarURL("20"),
 		},
@@ -773,29 +1178,51 @@ func (manager *BotManager) SendNormalMessage(channelId string, title string, msg
 	if fileds != nil {
 		embed.Fields = fileds
 	}
-	_, err := manager.discordSession.ChannelMessageSendEmbed(channelId, embed)
+	return embed
+}
+
+func (manager *BotManager) SendNormalMessage(channelId string, title string, msg string, fileds []*discordgo.MessageEmbedField) {
+	embed := manager.makeEmbed(title, msg, 0x00ff00, fileds)
+	_, err := manager.discord.ChannelMessageSendEmbed(channelId, embed)
 	if err != nil {
 		log.Println("Error sending normal embed message\n" + err.Error())
 	}
 }
 
 func (manager *BotManager) SendErrorMessage(channelId string, title string, msg string, fileds []*discordgo.MessageEmbedField) {
-	embed := &discordgo.MessageEmbed{
-		Title:       title,
-		Description: msg,
-		Color:       0xff0000,
-		Thumbnail: &discordgo.MessageEmbedThumbnail{
-			URL: manager.BotUserInfo.AvatarURL("20"),
-		},
+	embed := manager.makeEmbed(title, msg, 0xff0000, fileds)
+	_, err := manager.discord.ChannelMessageSendEmbed(channelId, embed)
+	if err != nil {
+		log.Println("Error sending error embed message\n" + err.Error())
 	}
+}
 
-	if fileds != nil {
-		embed.Fields = fileds
+// コマンドの実行元に応じてメッセージを返す(スラッシュコマンドの場合はインタラクションへの応答になる)
+func (manager *BotManager) replyNormal(arg *CommandArg, title string, msg string, fileds []*discordgo.MessageEmbedField) {
+	if arg.i == nil {
+		manager.SendNormalMessage(arg.m.ChannelID, title, msg, fileds)
+		return
 	}
-	_, err := manager.discordSession.ChannelMessageSendEmbed(channelId, embed)
-	if err != nil {
-		log.Println("Error sending error embed message\n" + err.Error())
+	embed := manager.makeEmbed(title, msg, 0x00ff00, fileds)
+	manager.respondInteraction(arg, "", []*discordgo.MessageEmbed{embed}, false)
+}
+
+// エラーはスラッシュコマンドの場合は実行者にのみ表示する
+func (manager *BotManager) replyError(arg *CommandArg, title string, msg string, fileds []*discordgo.MessageEmbedField) {
+	if arg.i == nil {
+		manager.SendErrorMessage(arg.m.ChannelID, title, msg, fileds)
+		return
+	}
+	embed := manager.makeEmbed(title, msg, 0xff0000, fileds)
+	manager.respondInteraction(arg, "", []*discordgo.MessageEmbed{embed}, true)
+}
+
+func (manager *BotManager) replyText(arg *CommandArg, msg string) {
+	if arg.i == nil {
+		manager.sendMessage(arg.m.ChannelID, msg)
+		return
 	}
+	manager.respondInteraction(arg, msg, nil, false)
 }
 
 func isVariable(token string) bool {
@@ -0,0 +1,522 @@
+package botmanager
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const testTemplate = "!gemubo settempl name=valo\n${GAMES}やる人 @${NUM:-4}"
+
+func TestHelpCommand(t *testing.T) {
+	b := newTestBot(t)
+
+	b.send(alice, "!gemubo help")
+	assertContains(t, b.lastText(), "コマンド一覧", "bosyu", "edit_bosyu", "remove_notion")
+
+	b.send(alice, "!gemubo help schedule")
+	assertContains(t, b.lastText(), "【コマンド】", "preset=<プリセット名>", "rule=cron:")
+}
+
+func TestHowUseAndTestCommands(t *testing.T) {
+	b := newTestBot(t)
+
+	b.send(alice, "!gemubo howuse")
+	assertContains(t, b.lastText(), "【テンプレートの登録】", "【募集の投稿】")
+
+	b.send(alice, "!gemubo test")
+	assertContains(t, b.lastText(), "全員集合～！", alice.Mention())
+}
+
+func TestInvalidCommand(t *testing.T) {
+	b := newTestBot(t)
+
+	b.send(alice, "!gemubo nosuchcommand")
+	assertContains(t, b.lastText(), "不正なコマンドです")
+
+	//!gemuboで始まらないメッセージには反応しない
+	if sent := b.send(alice, "こんにちは"); len(sent) != 0 {
+		t.Errorf("bot replied to a normal message: %q", messageText(sent[0]))
+	}
+}
+
+func TestTemplateCommands(t *testing.T) {
+	b := newTestBot(t)
+
+	b.send(alice, testTemplate)
+	assertContains(t, b.lastText(), "テンプレート「valo」を登録しました", "$GAMES", "$NUM")
+
+	b.send(alice, "!gemubo templs")
+	assertContains(t, b.lastText(), "テンプレート一覧", "valo")
+
+	b.send(alice, "!gemubo templs valo")
+	assertContains(t, b.lastText(), "${GAMES}やる人")
+
+	b.send(alice, "!gemubo remove_templ valo")
+	assertContains(t, b.lastText(), "テンプレート:valoを削除しました")
+
+	b.send(alice, "!gemubo templs valo")
+	assertContains(t, b.lastText(), "テンプレートが存在しません")
+}
+
+func TestSharedTemplateOwnership(t *testing.T) {
+	b := newTestBot(t)
+	const otherGuildId = "g2"
+
+	b.send(alice, "!gemubo settempl name=shared scope=global\n${GAME}やる人")
+	assertContains(t, b.lastText(), "共有テンプレート「shared」を登録しました")
+	b.sendInGuild(otherGuildId, bob, "!gemubo setpreset templname=shared presetname=p2\n$GAME=valo")
+	assertContains(t, b.lastText(), "プリセット「p2」を登録しました")
+
+	//他のサーバーからは上書きも削除もできない
+	b.sendInGuild(otherGuildId, bob, "!gemubo settempl name=shared scope=global\n上書き")
+	assertContains(t, b.lastText(), "他のサーバーが登録したものなので上書きできません")
+	b.sendInGuild(otherGuildId, bob, "!gemubo remove_templ shared scope=global")
+	assertContains(t, b.lastText(), "他のサーバーが登録したものなので削除できません")
+
+	//登録したサーバーからの上書きは他のサーバーのプリセットにも反映される
+	b.send(alice, "!gemubo settempl name=shared scope=global\n${GAME}やる人!")
+	assertContains(t, b.lastText(), "共有テンプレート「shared」を登録しました")
+	if preset := b.manager.guildPresets(otherGuildId)["p2"]; preset == nil || preset.Template.Content != "${GAME}やる人!\n" {
+		t.Errorf("preset in other guild does not see the update: %+v", preset)
+	}
+
+	//他のサーバーのプリセットが使っている間は削除できない
+	b.send(alice, "!gemubo remove_templ shared scope=global")
+	assertContains(t, b.lastText(), "他のサーバーのプリセット(1件)が利用しているため削除できません")
+	if _, exist := b.manager.guildPresets(otherGuildId)["p2"]; !exist {
+		t.Errorf("preset in other guild was deleted")
+	}
+
+	b.sendInGuild(otherGuildId, bob, "!gemubo remove_preset p2")
+	b.send(alice, "!gemubo setpreset templname=shared presetname=p1\n$GAME=apex")
+	b.send(alice, "!gemubo remove_templ shared scope=global")
+	assertContains(t, b.lastText(), "テンプレート:sharedを削除しました", "p1")
+	if _, exist := b.manager.findTemplate(otherGuildId, "shared"); exist {
+		t.Errorf("shared template was not deleted")
+	}
+}
+
+func TestPresetCommands(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, testTemplate)
+
+	//2行目以降は引用符なしでも空白を含む値を書ける
+	b.send(alice, "!gemubo setpreset templname=valo presetname=night\n$GAMES=valo OW\n$START_TIME=+1h")
+	assertContains(t, b.lastText(), "プリセット「night」を登録しました")
+
+	b.send(alice, "!gemubo presets")
+	assertContains(t, b.lastText(), "プリセット一覧", "night")
+
+	b.send(alice, "!gemubo presets night")
+	assertContains(t, b.lastText(), `$GAMES = "valo OW"`)
+
+	b.send(alice, "!gemubo bosyu preset=night")
+	gmsg := b.onlyBosyu()
+	if !strings.Contains(gmsg.Content, "valo OWやる人 @4") {
+		t.Errorf("bosyu content = %q", gmsg.Content)
+	}
+
+	b.send(alice, "!gemubo remove_preset night")
+	assertContains(t, b.lastText(), "プリセット:nightを削除しました")
+	b.send(alice, "!gemubo bosyu preset=night")
+	assertContains(t, b.lastText(), "プリセットが存在しません")
+}
+
+func TestBosyuStartsAndNotifiesParticipants(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, testTemplate)
+
+	b.send(alice, "!gemubo bosyu template=valo\n$GAMES=valo OW\n$START_TIME=+1h\n$REMIND=10m\n$MAX=1")
+	gmsg := b.onlyBosyu()
+	assertContains(t, gmsg.Content, "valo OWやる人")
+
+	b.react(bob, gmsg.MessgeId, b.manager.OkReaction)
+	b.react(carol, gmsg.MessgeId, b.manager.OkReaction)
+	//続けて押されたリアクションは少し待ってからまとめて反映される
+	b.clock.Advance(bosyuRefreshDelay)
+	embed := b.bosyuEmbed(gmsg)
+	assertContains(t, messageText(&discordgo.Message{Embeds: []*discordgo.MessageEmbed{embed}}), "【締切】", "参加者 (1/1人)", "キャンセル待ち (1人)")
+
+	b.send(alice, "!gemubo notions")
+	assertContains(t, b.lastText(), "募集一覧", "ID: "+gmsg.GemuboId, "リマインド:")
+
+	//定員の参加者が抜けるとキャンセル待ちが繰り上がる
+	b.unreact(bob, gmsg.MessgeId, b.manager.OkReaction)
+	assertContains(t, b.lastText(), carol.Mention())
+
+	b.clock.Advance(55 * time.Minute)
+	assertContains(t, b.lastText(), "開始10分前です！", alice.Mention(), carol.Mention())
+
+	b.clock.Advance(10 * time.Minute)
+	assertContains(t, b.lastText(), "全員しゅうごう～!", alice.Mention(), carol.Mention())
+	if len(b.manager.bosyuMsgs) != 0 {
+		t.Errorf("bosyu is still active after start")
+	}
+}
+
+func TestImmediateBosyuHasNoParticipantFields(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, testTemplate)
+	b.send(alice, "!gemubo bosyu template=valo $GAMES=valo")
+	msg := b.discord.LastMessage()
+	if len(msg.Embeds) == 0 {
+		t.Fatalf("bosyu message was not posted")
+	}
+	if len(b.manager.bosyuMsgs) != 0 {
+		t.Errorf("immediate bosyu is still active")
+	}
+	//即時開始の募集はリアクションを集計しないので、更新されない欄を出さない
+	if text := messageText(msg); strings.Contains(text, "参加者") || strings.Contains(text, "不参加") {
+		t.Errorf("immediate bosyu shows participant fields: %q", text)
+	}
+}
+
+func TestBosyuValidationErrors(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, "!gemubo settempl name=need\n${GAME:?ゲーム名}")
+
+	b.send(alice, "!gemubo bosyu template=need")
+	assertContains(t, b.lastText(), "以下の変数を指定してください", "$GAME (ゲーム名)")
+
+	b.send(alice, "!gemubo bosyu template=need $GAME=valo $MAX=zero $START_TIME=きのう")
+	assertContains(t, b.lastText(), "以下の変数の値が不正です", "$MAX", "$START_TIME")
+	//問題のある変数ごとに1つの欄にする
+	fields := b.discord.LastMessage().Embeds[0].Fields
+	if len(fields) != 2 || fields[0].Name != "$MAX" || fields[1].Name != "$START_TIME" {
+		t.Fatalf("error fields = %+v, want $MAX and $START_TIME", fields)
+	}
+	assertContains(t, fields[0].Value, "「zero」", "1以上の整数")
+
+	b.send(alice, "!gemubo bosyu")
+	assertContains(t, b.lastText(), "テンプレート名またはプリセット名が指定されていません")
+}
+
+func TestStartTimeUsesBotClock(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, testTemplate)
+	//時計を日付が変わる直前まで進めると、"0:30" は翌日になる
+	b.clock.Advance(11*time.Hour + 50*time.Minute)
+	b.send(alice, "!gemubo bosyu template=valo $GAMES=valo $START_TIME=0:30")
+	gmsg := b.onlyBosyu()
+	want := time.Date(2026, 4, 2, 0, 30, 0, 0, loadLocation(defaultTimezone))
+	if !gmsg.StartTime.Equal(want) {
+		t.Errorf("start = %v, want %v", gmsg.StartTime.In(want.Location()), want)
+	}
+}
+
+func TestEditBosyu(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, testTemplate)
+	b.send(alice, "!gemubo bosyu template=valo $GAMES=valo $START_TIME=+1h")
+	gmsg := b.onlyBosyu()
+	b.react(bob, gmsg.MessgeId, b.manager.OkReaction)
+	oldStart := *gmsg.StartTime
+
+	sent := b.send(alice, "!gemubo edit_bosyu "+gmsg.GemuboId+" $GAMES=apex $START_TIME=+2h")
+	assertContains(t, messagesText(sent), "募集を変更しました", bob.Mention(), "開始時刻:")
+	assertContains(t, gmsg.Content, "apexやる人")
+	if !gmsg.StartTime.After(oldStart) {
+		t.Errorf("start time was not changed")
+	}
+	assertContains(t, b.bosyuEmbed(gmsg).Description, "apexやる人")
+	if at, _ := b.manager.scheduler.Scheduled(gmsg.GemuboId); !at.Equal(*gmsg.StartTime) {
+		t.Errorf("start job at %v, want %v", at, *gmsg.StartTime)
+	}
+
+	//募集メッセージへの返信ではIDを省略できる
+	b.sendReply(alice, "!gemubo edit_bosyu $TITLE=今夜", gmsg.MessgeId)
+	if gmsg.Title != "今夜" {
+		t.Errorf("title = %q, want 今夜", gmsg.Title)
+	}
+
+	b.send(alice, "!gemubo edit_bosyu "+gmsg.GemuboId+" $START_TIME=NOW")
+	assertContains(t, b.lastText(), "以下の変数の値が不正です")
+}
+
+func TestPostponeAndStartNow(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, testTemplate)
+	b.send(alice, "!gemubo bosyu template=valo $GAMES=valo $START_TIME=+1h")
+	gmsg := b.onlyBosyu()
+	oldStart := *gmsg.StartTime
+
+	sent := b.send(alice, "!gemubo postpone "+gmsg.GemuboId+" +15m")
+	assertContains(t, messagesText(sent), "開始時刻を変更しました", "開始が15分遅れます")
+	if diff := gmsg.StartTime.Sub(oldStart); diff < 14*time.Minute || diff > 15*time.Minute {
+		t.Errorf("postponed by %v, want about 15m", diff)
+	}
+
+	b.sendReply(alice, "!gemubo postpone abc", gmsg.MessgeId)
+	assertContains(t, b.lastText(), "遅らせる時間を+15mのように指定してください")
+
+	b.send(alice, "!gemubo start_now "+gmsg.GemuboId)
+	assertContains(t, b.lastText(), "募集を開始しました")
+	//開始の通知はすぐに実行されるジョブから送られる
+	b.clock.Advance(0)
+	assertContains(t, b.lastText(), "全員しゅうごう～!")
+	if len(b.manager.bosyuMsgs) != 0 {
+		t.Errorf("bosyu is still active after start_now")
+	}
+}
+
+func TestBosyuCommandsRequireAuthorOrManager(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, testTemplate)
+	b.send(alice, "!gemubo bosyu template=valo $GAMES=valo $START_TIME=+1h")
+	gmsg := b.onlyBosyu()
+	oldStart := *gmsg.StartTime
+
+	//募集した人でも管理者でもないメンバーは変更・開始できない
+	b.send(bob, "!gemubo edit_bosyu "+gmsg.GemuboId+" $GAMES=apex")
+	assertContains(t, b.lastText(), "募集した人か「サーバー管理」の権限を持つメンバーだけが変更できます")
+	b.send(bob, "!gemubo postpone "+gmsg.GemuboId+" +15m")
+	assertContains(t, b.lastText(), "だけが変更できます")
+	b.send(bob, "!gemubo start_now "+gmsg.GemuboId)
+	assertContains(t, b.lastText(), "だけが開始できます")
+	b.clock.Advance(0)
+	if !strings.HasPrefix(gmsg.Content, "valoやる人") || !gmsg.StartTime.Equal(oldStart) || len(b.manager.bosyuMsgs) != 1 {
+		t.Fatalf("bosyu was changed by another member: %q %v", gmsg.Content, gmsg.StartTime)
+	}
+
+	//サーバー管理の権限があれば変更できる
+	b.discord.Permissions[bob.ID] = discordgo.PermissionManageServer
+	b.send(bob, "!gemubo edit_bosyu "+gmsg.GemuboId+" $GAMES=apex")
+	assertContains(t, gmsg.Content, "apexやる人")
+	b.send(bob, "!gemubo start_now "+gmsg.GemuboId)
+	b.clock.Advance(0)
+	if len(b.manager.bosyuMsgs) != 0 {
+		t.Errorf("manager could not start the bosyu")
+	}
+}
+
+func TestRemoveNotionCancelsBosyu(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, testTemplate)
+	b.send(alice, "!gemubo bosyu template=valo $GAMES=valo $START_TIME=+1h")
+	gmsg := b.onlyBosyu()
+	b.react(bob, gmsg.MessgeId, b.manager.OkReaction)
+
+	sent := b.send(alice, "!gemubo remove_notion "+gmsg.GemuboId+" reason=\"急用 のため\"")
+	assertContains(t, messagesText(sent), bob.Mention(), "中止になりました", "理由: 急用 のため", "募集を中止しました")
+	assertContains(t, b.bosyuEmbed(gmsg).Title, "【中止】")
+	if !gmsg.Canceled || len(b.manager.bosyuMsgs) != 0 {
+		t.Errorf("bosyu was not canceled")
+	}
+
+	//開始時刻になっても通知されない
+	before := len(b.discord.Messages)
+	b.clock.Advance(2 * time.Hour)
+	if len(b.discord.Messages) != before {
+		t.Errorf("canceled bosyu sent %q", b.lastText())
+	}
+
+	b.send(alice, "!gemubo remove_notion "+gmsg.GemuboId)
+	assertContains(t, b.lastText(), "指定されたIDの募集は存在しません")
+}
+
+func TestQuorumCancelsWhenCheckWindowPassed(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, "!gemubo settempl name=timed\n${GAMES} 開始:$START_TIME")
+	//確認時刻を過ぎてから投稿しても開始時刻に確認する
+	b.send(alice, "!gemubo bosyu template=timed $GAMES=valo $START_TIME=+5m $MIN=3 $MIN_CHECK=30m")
+	gmsg := b.onlyBosyu()
+	b.react(bob, gmsg.MessgeId, b.manager.OkReaction)
+
+	b.clock.Advance(10 * time.Minute)
+	if !gmsg.Canceled {
+		t.Fatalf("bosyu without quorum was not canceled")
+	}
+	for _, msg := range b.discord.Messages {
+		if strings.Contains(messageText(msg), "全員しゅうごう") {
+			t.Errorf("start notification was sent without quorum")
+		}
+	}
+
+	dm := b.discord.LastMessage()
+	if dm.ChannelID != "dm-"+alice.ID || len(dm.Components) == 0 {
+		t.Fatalf("author did not get an extend button: %q", messageText(dm))
+	}
+
+	b.manager.onInteractionCreate(&discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			Type: discordgo.InteractionMessageComponent,
+			User: alice,
+			Data: discordgo.MessageComponentInteractionData{CustomID: quorumExtendPrefix + gmsg.GemuboId},
+		},
+	})
+	if gmsg.Canceled || len(b.manager.bosyuMsgs) != 1 {
+		t.Fatalf("bosyu was not extended")
+	}
+	//本文の開始時刻も延長後の時刻になり、あとから編集しても開始時刻は変わらない
+	startText := gmsg.StartTime.In(loadLocation(defaultTimezone)).Format("1/2 15:04")
+	assertContains(t, gmsg.Content, "開始:"+startText)
+	startTime := *gmsg.StartTime
+	sent := b.send(alice, "!gemubo edit_bosyu "+gmsg.GemuboId+" $GAMES=apex")
+	assertContains(t, messagesText(sent), "募集を変更しました")
+	assertContains(t, gmsg.Content, "apex 開始:"+startText)
+	if !gmsg.StartTime.Equal(startTime) {
+		t.Errorf("edit moved the start from %v to %v", startTime, *gmsg.StartTime)
+	}
+}
+
+func TestReactionRefreshIsDebounced(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, testTemplate)
+	b.send(alice, "!gemubo bosyu template=valo $GAMES=valo $START_TIME=+1h")
+	gmsg := b.onlyBosyu()
+
+	b.react(bob, gmsg.MessgeId, b.manager.OkReaction)
+	b.react(carol, gmsg.MessgeId, b.manager.OkReaction)
+	if _, exist := b.manager.scheduler.Scheduled(refreshJobId(gmsg.GemuboId)); !exist {
+		t.Fatalf("refresh job was not scheduled")
+	}
+	assertContains(t, messageText(&discordgo.Message{Embeds: []*discordgo.MessageEmbed{b.bosyuEmbed(gmsg)}}), "参加者 (0人)")
+
+	b.clock.Advance(bosyuRefreshDelay)
+	assertContains(t, messageText(&discordgo.Message{Embeds: []*discordgo.MessageEmbed{b.bosyuEmbed(gmsg)}}), "参加者 (2人)")
+}
+
+func TestMaybeReaction(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, testTemplate)
+	b.send(alice, "!gemubo bosyu template=valo $GAMES=valo $START_TIME=+1h")
+	gmsg := b.onlyBosyu()
+	b.react(bob, gmsg.MessgeId, b.manager.OkReaction)
+	b.react(carol, gmsg.MessgeId, b.manager.MaybeReaction)
+	b.clock.Advance(bosyuRefreshDelay)
+	assertContains(t, messageText(&discordgo.Message{Embeds: []*discordgo.MessageEmbed{b.bosyuEmbed(gmsg)}}), "未定 (1人)")
+
+	b.clock.Advance(2 * time.Hour)
+	last := b.discord.Messages[len(b.discord.Messages)-2:]
+	if strings.Contains(last[0].Content, carol.Mention()) {
+		t.Errorf("maybe user was mentioned with the participants: %q", last[0].Content)
+	}
+	assertContains(t, last[1].Content, "来れたら来てね", carol.Mention())
+}
+
+func TestMaybeReactionDisabled(t *testing.T) {
+	b := newTestBot(t)
+	b.manager.MaybeReaction = ""
+	b.send(alice, testTemplate)
+	b.send(alice, "!gemubo bosyu template=valo $GAMES=valo $START_TIME=+1h")
+	gmsg := b.onlyBosyu()
+
+	users, _ := b.discord.MessageReactions(testChannelId, gmsg.MessgeId, "🤔", 100, "", "")
+	if len(users) != 0 {
+		t.Errorf("maybe reaction was added")
+	}
+	b.react(carol, gmsg.MessgeId, "🤔")
+	if text := messageText(&discordgo.Message{Embeds: []*discordgo.MessageEmbed{b.bosyuEmbed(gmsg)}}); strings.Contains(text, "未定") {
+		t.Errorf("maybe field is shown: %q", text)
+	}
+}
+
+func TestScheduleCommands(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, "!gemubo settempl name=timed\n${GAMES}やる人 開始:$START_TIME")
+	b.send(alice, "!gemubo setpreset templname=timed presetname=night $GAMES=valo")
+
+	//cronのルールは2行目に空白を含めてそのまま書ける
+	//日付が変わった後に始まる募集を前日に投稿する
+	b.send(alice, "!gemubo schedule preset=night lead=13h\nrule=cron:30 0 * * *")
+	assertContains(t, b.lastText(), "定期募集(ID:", "を登録しました", "次回開始")
+
+	var scheduleId string
+	for id := range b.manager.schedules {
+		scheduleId = id
+	}
+
+	b.send(alice, "!gemubo schedules")
+	assertContains(t, b.lastText(), "定期募集一覧", "ID: "+scheduleId, "プリセット:night")
+
+	//次回の投稿時刻になると募集が投稿される
+	postAt, exist := b.manager.scheduler.Scheduled(scheduleJobId(scheduleId))
+	if !exist {
+		t.Fatalf("schedule post is not planned")
+	}
+	b.clock.Advance(postAt.Sub(b.clock.Now()))
+	gmsg := b.onlyBosyu()
+	//本文の開始時刻には日付も入る
+	startText := gmsg.StartTime.In(loadLocation(defaultTimezone)).Format("1/2 15:04")
+	assertContains(t, gmsg.Content, "valoやる人 開始:"+startText)
+	assertContains(t, startText, " 00:30")
+
+	b.send(alice, "!gemubo remove_schedule "+scheduleId)
+	assertContains(t, b.lastText(), "定期募集を削除しました")
+	if len(b.manager.schedules) != 0 {
+		t.Errorf("schedule was not removed")
+	}
+}
+
+func TestTimezoneCommands(t *testing.T) {
+	b := newTestBot(t)
+
+	b.send(alice, "!gemubo tz")
+	assertContains(t, b.lastText(), "Asia/Tokyo")
+
+	b.send(alice, "!gemubo tz America/Los_Angeles")
+	assertContains(t, b.lastText(), "America/Los_Angeles")
+	if loc := b.manager.userLocation(testGuildId, alice.ID); loc.String() != "America/Los_Angeles" {
+		t.Errorf("user location = %s", loc)
+	}
+
+	b.send(alice, "!gemubo tz Mars/Olympus")
+	assertContains(t, b.lastText(), "タイムゾーン名が不正です")
+
+	b.send(alice, "!gemubo guild_tz")
+	assertContains(t, b.lastText(), "このサーバーのタイムゾーンは Asia/Tokyo です")
+
+	//サーバー管理の権限がないと設定できない
+	b.send(alice, "!gemubo guild_tz Europe/London")
+	assertContains(t, b.lastText(), "「サーバー管理」の権限を持つメンバーだけが設定できます")
+	b.slash(alice, "guild_tz", "timezone", "Europe/London")
+	assertContains(t, messageText(&discordgo.Message{Embeds: b.discord.Responses[len(b.discord.Responses)-1].Embeds}), "「サーバー管理」の権限")
+
+	b.discord.Permissions[alice.ID] = discordgo.PermissionManageServer
+	b.send(alice, "!gemubo guild_tz Europe/London")
+	assertContains(t, b.lastText(), "Europe/London に設定しました")
+	if loc := b.manager.userLocation(testGuildId, bob.ID); loc.String() != "Europe/London" {
+		t.Errorf("guild location = %s", loc)
+	}
+}
+
+func TestSlashCommand(t *testing.T) {
+	b := newTestBot(t)
+	//開発用の test コマンドはスラッシュコマンドにしない
+	if len(b.discord.Commands) != len(b.manager.commands)-1 {
+		t.Errorf("registered %d slash commands, want %d", len(b.discord.Commands), len(b.manager.commands)-1)
+	}
+	for _, command := range b.discord.Commands {
+		if command.Name == "test" {
+			t.Errorf("dev-only command was registered as a slash command")
+		}
+	}
+
+	b.slash(alice, "settempl", "name", "slash", "content", `1行目\n$GAME`)
+	//3秒以内に応答するため、最初に応答を保留して結果は保留した応答を書き換えて返す
+	if len(b.discord.ResponseTypes) != 1 || b.discord.ResponseTypes[0] != discordgo.InteractionResponseDeferredChannelMessageWithSource {
+		t.Fatalf("response types = %v, want a deferred response", b.discord.ResponseTypes)
+	}
+	if len(b.discord.Responses) != 1 {
+		t.Fatalf("%d responses, want 1", len(b.discord.Responses))
+	}
+	assertContains(t, messageText(&discordgo.Message{Embeds: b.discord.Responses[0].Embeds}), "テンプレート「slash」を登録しました")
+	template, exist := b.manager.findTemplate(testGuildId, "slash")
+	if !exist || strings.TrimSpace(template.Content) != "1行目\n$GAME" {
+		t.Errorf("template = %+v", template)
+	}
+
+	//エラーは保留した応答を消して実行者にだけ見えるように送る
+	b.slash(alice, "templs", "name", "none")
+	if b.discord.DeletedResponses != 1 {
+		t.Errorf("deleted %d responses, want 1", b.discord.DeletedResponses)
+	}
+	last := b.discord.Responses[len(b.discord.Responses)-1]
+	if last.Flags&discordgo.MessageFlagsEphemeral == 0 {
+		t.Errorf("error response is not ephemeral")
+	}
+	assertContains(t, messageText(&discordgo.Message{Embeds: last.Embeds}), "テンプレートが存在しません")
+}
@@ -0,0 +1,43 @@
+package botmanager
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// DiscordClient はBOTが使うDiscordのAPI(*discordgo.Session が満たす)
+// テストではメッセージを記録するだけの fakeDiscordClient(fakediscord_test.go)に差し替える
+type DiscordClient interface {
+	ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageSendReply(channelID string, content string, reference *discordgo.MessageReference, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ChannelMessageEditEmbed(channelID, messageID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	MessageReactions(channelID, messageID, emojiID string, limit int, beforeID, afterID string, options ...discordgo.RequestOption) ([]*discordgo.User, error)
+	MessageReactionAdd(channelID, messageID, emojiID string, options ...discordgo.RequestOption) error
+	MessageReactionsRemoveAll(channelID, messageID string, options ...discordgo.RequestOption) error
+	UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error)
+	UserChannelPermissions(userID, channelID string, fetchOptions ...discordgo.RequestOption) (int64, error)
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+	InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	InteractionResponseDelete(interaction *discordgo.Interaction, options ...discordgo.RequestOption) error
+	FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	ApplicationCommandBulkOverwrite(appID string, guildID string, commands []*discordgo.ApplicationCommand, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error)
+}
+
+var _ DiscordClient = (*discordgo.Session)(nil)
+
+// Discordのイベントを manager のハンドラに渡すように登録する
+func (manager *BotManager) AddHandlers(session *discordgo.Session) {
+	session.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
+		manager.onDiscordMessageCreate(m)
+	})
+	session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		manager.onInteractionCreate(i)
+	})
+	session.AddHandler(func(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+		manager.onMessageReactionAdd(r)
+	})
+	session.AddHandler(func(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+		manager.onMessageReactionRemove(r)
+	})
+}
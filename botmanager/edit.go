@@ -0,0 +1,161 @@
+package botmanager
+
+import (
+	"fmt"
+	"gemubobot/gemubo"
+	"gemubobot/lib"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func onEditBosyu(arg *CommandArg, manager *BotManager) {
+	title := arg.commandName
+	gmsg, errmsg := manager.resolveBosyu(arg, arg.values["id"])
+	if gmsg == nil {
+		manager.replyError(arg, title, errmsg, nil)
+		return
+	}
+	if !manager.canModifyBosyu(arg, gmsg) {
+		manager.replyError(arg, title, "募集した人か「サーバー管理」の権限を持つメンバーだけが変更できます", nil)
+		return
+	}
+	if len(arg.variables) == 0 {
+		manager.replyError(arg, title, "変更する変数を<変数名>=<値>の形式で指定してください", nil)
+		return
+	}
+
+	oldStartTime := *gmsg.StartTime
+	oldContent := gmsg.Content
+	oldOffsets := gmsg.RemindOffsets
+
+	loc := manager.userLocation(arg.m.GuildID, arg.m.Author.ID)
+	if err := gmsg.Edit(arg.variables, manager.now(), loc); err != nil {
+		manager.replyError(arg, title, makeMessageErrorText(err), makeMessageErrorFields(err))
+		return
+	}
+
+	template := gemubo.NewTemplate(gmsg.GuildId, "", gmsg.TemplateContent)
+	if warning := variableWarningText(template.CheckParams(gmsg.Params)); warning != "" {
+		manager.replyNormal(arg, "注意", warning, nil)
+	}
+
+	//開始時刻やリマインドが変わっている場合があるので登録し直す
+	manager.cancelBosyuJobs(gmsg.GemuboId, oldOffsets)
+	manager.scheduleBosyu(gmsg)
+	manager.refreshBosyuEmbed(gmsg)
+	manager.saveState()
+
+	msg := ""
+	if !gmsg.StartTime.Equal(oldStartTime) {
+		msg += startTimeChangeText(oldStartTime, *gmsg.StartTime)
+	}
+	if gmsg.Content != oldContent || msg == "" {
+		msg += "募集内容が変更されました。募集メッセージを確認してください\n"
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("募集(ID:%s)が変更されました", gmsg.GemuboId),
+		Description: msg,
+		Color:       0x00F1AA,
+	}
+	manager.sendMentionReply(gmsg, participantMentions(gmsg), embed)
+
+	manager.replyNormal(arg, "", fmt.Sprintf("ID:%sの募集を変更しました", gmsg.GemuboId), nil)
+}
+
+func startTimeChangeText(oldStartTime time.Time, newStartTime time.Time) string {
+	return fmt.Sprintf("開始時刻: ~~%s~~ → %s (%s)\n", lib.DiscordTimestamp(oldStartTime, "f"), lib.DiscordTimestamp(newStartTime, "f"), lib.DiscordTimestamp(newStartTime, "R"))
+}
+
+func onPostponeCommand(arg *CommandArg, manager *BotManager) {
+	title := arg.commandName
+	gemuboId, delayStr := arg.values["id"], arg.values["delay"]
+	//募集メッセージへの返信では「postpone +15m」のようにIDを省略できる
+	if delayStr == "" {
+		if _, err := time.ParseDuration(gemuboId); err == nil {
+			gemuboId, delayStr = "", gemuboId
+		}
+	}
+	if delayStr == "" {
+		manager.replyError(arg, title, "遅らせる時間を+15mのように指定してください", nil)
+		return
+	}
+	delay, err := time.ParseDuration(delayStr)
+	if err != nil || delay < time.Minute {
+		manager.replyError(arg, title, "遅らせる時間は+15mや+1h30mのように1分以上で指定してください", nil)
+		return
+	}
+
+	gmsg, errmsg := manager.resolveBosyu(arg, gemuboId)
+	if gmsg == nil {
+		manager.replyError(arg, title, errmsg, nil)
+		return
+	}
+	if !manager.canModifyBosyu(arg, gmsg) {
+		manager.replyError(arg, title, "募集した人か「サーバー管理」の権限を持つメンバーだけが変更できます", nil)
+		return
+	}
+
+	oldStartTime := *gmsg.StartTime
+	loc := manager.userLocation(arg.m.GuildID, arg.m.Author.ID)
+	if err := manager.moveBosyuStart(gmsg, oldStartTime.Add(delay), loc); err != nil {
+		manager.replyError(arg, title, makeMessageErrorText(err), makeMessageErrorFields(err))
+		return
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("募集(ID:%s)の開始が%s遅れます", gmsg.GemuboId, formatOffset(delay)),
+		Description: startTimeChangeText(oldStartTime, *gmsg.StartTime),
+		Color:       0x00F1AA,
+	}
+	manager.sendMentionReply(gmsg, participantMentions(gmsg), embed)
+
+	manager.replyNormal(arg, "", fmt.Sprintf("ID:%sの募集の開始時刻を変更しました", gmsg.GemuboId), nil)
+}
+
+// 開始時刻を変更して通知を登録し直す
+func (manager *BotManager) moveBosyuStart(gmsg *gemubo.GemuboMessage, startTime time.Time, loc *time.Location) error {
+	oldOffsets := gmsg.RemindOffsets
+	if gmsg.TemplateContent != "" {
+		//本文の$START_TIMEも書き換わるように作り直す
+		updates := map[string]string{
+			"$START_TIME": startTime.In(loc).Format("1/2 15:04"),
+		}
+		if err := gmsg.Edit(updates, manager.now(), loc); err != nil {
+			return err
+		}
+	} else {
+		gmsg.StartTime = &startTime
+	}
+
+	manager.cancelBosyuJobs(gmsg.GemuboId, oldOffsets)
+	manager.scheduleBosyu(gmsg)
+	manager.refreshBosyuEmbed(gmsg)
+	manager.saveState()
+	return nil
+}
+
+func onStartNowCommand(arg *CommandArg, manager *BotManager) {
+	title := arg.commandName
+	gmsg, errmsg := manager.resolveBosyu(arg, arg.values["id"])
+	if gmsg == nil {
+		manager.replyError(arg, title, errmsg, nil)
+		return
+	}
+	if !manager.canModifyBosyu(arg, gmsg) {
+		manager.replyError(arg, title, "募集した人か「サーバー管理」の権限を持つメンバーだけが開始できます", nil)
+		return
+	}
+
+	//募集メッセージの開始時刻を今にして、開始のジョブをすぐに実行させる
+	//(参加者はジョブの中でロックの外から取得する)
+	now := manager.now()
+	gemuboId := gmsg.GemuboId
+	manager.cancelBosyuJobs(gemuboId, gmsg.RemindOffsets)
+	gmsg.StartTime = &now
+	gmsg.QuorumChecked = true
+	manager.scheduleBosyu(gmsg)
+	manager.refreshBosyuEmbed(gmsg)
+
+	manager.replyNormal(arg, "", fmt.Sprintf("ID:%sの募集を開始しました", gemuboId), nil)
+}
@@ -0,0 +1,253 @@
+package botmanager
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeDiscordClient はDiscordに接続せずに送信したメッセージを記録する DiscordClient
+// リアクションは SimulateReaction でユーザーが押したことにできる
+type fakeDiscordClient struct {
+	mu sync.Mutex
+	//BOT自身(MessageReactionAdd で押したリアクションのユーザー)
+	BotUser *discordgo.User
+	//送信・編集されたメッセージ(送信順)
+	Messages []*discordgo.Message
+	//インタラクションへの応答(保留した応答の編集とフォローアップを含む)
+	Responses []*discordgo.InteractionResponseData
+	//InteractionRespond で返した応答の種類
+	ResponseTypes []discordgo.InteractionResponseType
+	//InteractionResponseDelete で消された応答の数
+	DeletedResponses int
+	Commands         []*discordgo.ApplicationCommand
+	//ユーザーID -> UserChannelPermissions で返す権限(チャンネルによらない)
+	Permissions map[string]int64
+	//メッセージID -> 絵文字 -> リアクションしたユーザー
+	reactions map[string]map[string][]*discordgo.User
+	nextId    int
+}
+
+func newFakeDiscordClient(botUser *discordgo.User) *fakeDiscordClient {
+	return &fakeDiscordClient{
+		BotUser:     botUser,
+		Messages:    make([]*discordgo.Message, 0),
+		Responses:   make([]*discordgo.InteractionResponseData, 0),
+		Permissions: make(map[string]int64),
+		reactions:   make(map[string]map[string][]*discordgo.User),
+	}
+}
+
+func (f *fakeDiscordClient) newMessage(channelID string, content string, embeds []*discordgo.MessageEmbed) *discordgo.Message {
+	f.nextId++
+	msg := &discordgo.Message{
+		ID:        fmt.Sprintf("%d", f.nextId),
+		ChannelID: channelID,
+		Content:   content,
+		Embeds:    embeds,
+		Author:    f.BotUser,
+	}
+	f.Messages = append(f.Messages, msg)
+	return msg
+}
+
+func (f *fakeDiscordClient) ChannelMessageSend(channelID string, content string, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.newMessage(channelID, content, nil), nil
+}
+
+func (f *fakeDiscordClient) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	embeds := data.Embeds
+	if data.Embed != nil {
+		embeds = append([]*discordgo.MessageEmbed{data.Embed}, embeds...)
+	}
+	msg := f.newMessage(channelID, data.Content, embeds)
+	msg.MessageReference = data.Reference
+	msg.Components = data.Components
+	return msg, nil
+}
+
+func (f *fakeDiscordClient) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.newMessage(channelID, "", []*discordgo.MessageEmbed{embed}), nil
+}
+
+func (f *fakeDiscordClient) ChannelMessageSendReply(channelID string, content string, reference *discordgo.MessageReference, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg := f.newMessage(channelID, content, nil)
+	msg.MessageReference = reference
+	return msg, nil
+}
+
+func (f *fakeDiscordClient) ChannelMessageEditEmbed(channelID, messageID string, embed *discordgo.MessageEmbed, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg, exist := f.findMessage(messageID)
+	if !exist {
+		return nil, fmt.Errorf("unknown message %s", messageID)
+	}
+	msg.Embeds = []*discordgo.MessageEmbed{embed}
+	return msg, nil
+}
+
+func (f *fakeDiscordClient) findMessage(messageID string) (*discordgo.Message, bool) {
+	for _, msg := range f.Messages {
+		if msg.ID == messageID {
+			return msg, true
+		}
+	}
+	return nil, false
+}
+
+// 記録されたメッセージを取得する
+func (f *fakeDiscordClient) Message(messageID string) (*discordgo.Message, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.findMessage(messageID)
+}
+
+// 最後に送信されたメッセージ(まだない場合はnil)
+func (f *fakeDiscordClient) LastMessage() *discordgo.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.Messages) == 0 {
+		return nil
+	}
+	return f.Messages[len(f.Messages)-1]
+}
+
+// 実際のAPIと同じくユーザーIDの順に after より後のユーザーを返す
+func (f *fakeDiscordClient) MessageReactions(channelID, messageID, emojiID string, limit int, beforeID, afterID string, options ...discordgo.RequestOption) ([]*discordgo.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	users := append([]*discordgo.User(nil), f.reactions[messageID][emojiID]...)
+	sort.Slice(users, func(a, b int) bool {
+		return users[a].ID < users[b].ID
+	})
+
+	page := make([]*discordgo.User, 0)
+	for _, user := range users {
+		if afterID != "" && user.ID <= afterID {
+			continue
+		}
+		if len(page) >= limit {
+			break
+		}
+		page = append(page, user)
+	}
+	return page, nil
+}
+
+func (f *fakeDiscordClient) MessageReactionAdd(channelID, messageID, emojiID string, options ...discordgo.RequestOption) error {
+	f.SimulateReaction(messageID, emojiID, f.BotUser)
+	return nil
+}
+
+func (f *fakeDiscordClient) MessageReactionsRemoveAll(channelID, messageID string, options ...discordgo.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.reactions, messageID)
+	return nil
+}
+
+// user がリアクションを押したことにする(BOTのハンドラは呼ばれないので必要なら別に呼ぶ)
+func (f *fakeDiscordClient) SimulateReaction(messageID string, emoji string, user *discordgo.User) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, exist := f.reactions[messageID]; !exist {
+		f.reactions[messageID] = make(map[string][]*discordgo.User)
+	}
+	for _, u := range f.reactions[messageID][emoji] {
+		if u.ID == user.ID {
+			return
+		}
+	}
+	f.reactions[messageID][emoji] = append(f.reactions[messageID][emoji], user)
+}
+
+// user がリアクションを外したことにする
+func (f *fakeDiscordClient) SimulateReactionRemove(messageID string, emoji string, user *discordgo.User) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	users := f.reactions[messageID][emoji]
+	for idx, u := range users {
+		if u.ID == user.ID {
+			f.reactions[messageID][emoji] = append(users[:idx], users[idx+1:]...)
+			return
+		}
+	}
+}
+
+// DMのチャンネルIDは "dm-<ユーザーID>" になる
+func (f *fakeDiscordClient) UserChannelCreate(recipientID string, options ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	return &discordgo.Channel{
+		ID:   "dm-" + recipientID,
+		Type: discordgo.ChannelTypeDM,
+	}, nil
+}
+
+func (f *fakeDiscordClient) UserChannelPermissions(userID, channelID string, fetchOptions ...discordgo.RequestOption) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Permissions[userID], nil
+}
+
+func (f *fakeDiscordClient) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ResponseTypes = append(f.ResponseTypes, resp.Type)
+	if resp.Data != nil {
+		f.Responses = append(f.Responses, resp.Data)
+	}
+	return nil
+}
+
+func (f *fakeDiscordClient) InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data := &discordgo.InteractionResponseData{}
+	if newresp.Content != nil {
+		data.Content = *newresp.Content
+	}
+	if newresp.Embeds != nil {
+		data.Embeds = *newresp.Embeds
+	}
+	f.Responses = append(f.Responses, data)
+	f.nextId++
+	return &discordgo.Message{ID: fmt.Sprintf("%d", f.nextId), Content: data.Content, Embeds: data.Embeds}, nil
+}
+
+func (f *fakeDiscordClient) InteractionResponseDelete(interaction *discordgo.Interaction, options ...discordgo.RequestOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.DeletedResponses++
+	return nil
+}
+
+func (f *fakeDiscordClient) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Responses = append(f.Responses, &discordgo.InteractionResponseData{
+		Content: data.Content,
+		Embeds:  data.Embeds,
+		Flags:   data.Flags,
+	})
+	f.nextId++
+	return &discordgo.Message{ID: fmt.Sprintf("%d", f.nextId), Content: data.Content, Embeds: data.Embeds}, nil
+}
+
+func (f *fakeDiscordClient) ApplicationCommandBulkOverwrite(appID string, guildID string, commands []*discordgo.ApplicationCommand, options ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Commands = commands
+	return commands, nil
+}
+
+var _ DiscordClient = (*fakeDiscordClient)(nil)
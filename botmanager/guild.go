@@ -0,0 +1,89 @@
+package botmanager
+
+import (
+	"gemubobot/gemubo"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// 全サーバーから参照できる共有テンプレートの名前空間
+const sharedGuildId = "shared"
+
+func (manager *BotManager) guildTemplates(guildId string) map[string]*gemubo.Template {
+	templates, exist := manager.templates[guildId]
+	if !exist {
+		templates = make(map[string]*gemubo.Template)
+		manager.templates[guildId] = templates
+	}
+	return templates
+}
+
+func (manager *BotManager) guildPresets(guildId string) map[string]*gemubo.Preset {
+	presets, exist := manager.presets[guildId]
+	if !exist {
+		presets = make(map[string]*gemubo.Preset)
+		manager.presets[guildId] = presets
+	}
+	return presets
+}
+
+// サーバーのテンプレートを優先し、なければ共有テンプレートから探す
+func (manager *BotManager) findTemplate(guildId string, name string) (*gemubo.Template, bool) {
+	if template, exist := manager.guildTemplates(guildId)[name]; exist {
+		return template, true
+	}
+	template, exist := manager.guildTemplates(sharedGuildId)[name]
+	return template, exist
+}
+
+// 指定したサーバーの募集を返す
+func (manager *BotManager) guildBosyuMsg(guildId string, gemuboId string) (*gemubo.GemuboMessage, bool) {
+	gmsg, exist := manager.bosyuMsgs[gemuboId]
+	if !exist || gmsg.GuildId != guildId {
+		return nil, false
+	}
+	return gmsg, true
+}
+
+// 共有テンプレートを上書き・削除できるのは登録したサーバーだけ
+// 登録したサーバーが記録される前の共有テンプレートは最初に変更したサーバーのものになる
+func canModifyTemplate(template *gemubo.Template, guildId string) bool {
+	if template.GuildId != sharedGuildId {
+		return template.GuildId == guildId
+	}
+	return template.OwnerGuildId == "" || template.OwnerGuildId == guildId
+}
+
+// 募集を変更・開始できるのは募集した人とサーバーの管理権限を持つメンバーだけ
+func (manager *BotManager) canModifyBosyu(arg *CommandArg, gmsg *gemubo.GemuboMessage) bool {
+	if gmsg.Author != nil && gmsg.Author.ID == arg.m.Author.ID {
+		return true
+	}
+	return manager.canManageGuild(arg)
+}
+
+// コマンドの実行者がサーバーの管理権限(サーバー管理または管理者)を持っているか
+func (manager *BotManager) canManageGuild(arg *CommandArg) bool {
+	var permissions int64
+	if arg.i != nil {
+		//スラッシュコマンドの場合は実行者の権限がインタラクションに含まれる
+		if arg.i.Member == nil {
+			return false
+		}
+		permissions = arg.i.Member.Permissions
+	} else {
+		perms, err := manager.discord.UserChannelPermissions(arg.m.Author.ID, arg.m.ChannelID)
+		if err != nil {
+			log.Println("Error getting user permissions\n" + err.Error())
+			return false
+		}
+		permissions = perms
+	}
+	return permissions&(discordgo.PermissionManageServer|discordgo.PermissionAdministrator) != 0
+}
+
+func isSharedScope(params map[string]string) bool {
+	scope, exist := params["scope"]
+	return exist && scope == "global"
+}
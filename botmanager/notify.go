@@ -0,0 +1,271 @@
+package botmanager
+
+import (
+	"fmt"
+	"gemubobot/gemubo"
+	"gemubobot/lib"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	//Discordのメッセージ本文の最大文字数
+	maxMessageContentLen = 2000
+	//リアクションしたユーザーを一度に取得できる最大数
+	reactionPageLimit = 100
+)
+
+type reactionLister interface {
+	MessageReactions(channelID, messageID, emojiID string, limit int, beforeID, afterID string, options ...discordgo.RequestOption) ([]*discordgo.User, error)
+}
+
+// リアクションしたユーザーをafterカーソルでページングして全員取得する
+func fetchReactionUsers(lister reactionLister, channelId string, messageId string, emoji string) ([]*discordgo.User, error) {
+	users := make([]*discordgo.User, 0)
+	after := ""
+	for {
+		page, err := lister.MessageReactions(channelId, messageId, emoji, reactionPageLimit, "", after)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, page...)
+
+		if len(page) < reactionPageLimit {
+			return users, nil
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
+// 募集メッセージに付いているリアクション(状態ごとのユーザー)
+type bosyuReactions map[gemubo.ParticipantStatus][]*discordgo.User
+
+func (manager *BotManager) reactionEmojis() map[gemubo.ParticipantStatus]string {
+	emojis := map[gemubo.ParticipantStatus]string{
+		gemubo.ParticipantOk: manager.OkReaction,
+		gemubo.ParticipantNo: manager.NoReaction,
+	}
+	if manager.MaybeReaction != "" {
+		emojis[gemubo.ParticipantMaybe] = manager.MaybeReaction
+	}
+	return emojis
+}
+
+// 状態には触れないのでロックを取らずに呼ぶ
+func (manager *BotManager) fetchBosyuReactions(channelId string, messageId string) (bosyuReactions, error) {
+	reactions := make(bosyuReactions)
+	for status, emoji := range manager.reactionEmojis() {
+		users, err := fetchReactionUsers(manager.discord, channelId, messageId, emoji)
+		if err != nil {
+			return nil, err
+		}
+		reactions[status] = users
+	}
+	return reactions, nil
+}
+
+// 実際のリアクションと参加者一覧を突き合わせる(BOT停止中のリアクションを取りこぼさないため)
+func (manager *BotManager) applyReactions(gmsg *gemubo.GemuboMessage, reactions bosyuReactions) {
+	now := manager.now()
+	for status, users := range reactions {
+		reacted := make(map[string]bool)
+		for _, user := range users {
+			if user.ID == manager.BotUserInfo.ID {
+				continue
+			}
+			reacted[user.ID] = true
+			gmsg.AddParticipant(user.ID, status, now)
+		}
+
+		for _, p := range gmsg.ParticipantsByStatus(status) {
+			if !reacted[p.UserId] {
+				gmsg.RemoveParticipant(p.UserId, status)
+			}
+		}
+	}
+}
+
+// find で見つけた募集のリアクションをロックの外で取得して参加者に反映し、ロックを取ったまま fn を実行する
+// 参加者が多いとページングで何度もAPIを呼ぶので、その間も他のイベントを処理できるようにする
+func (manager *BotManager) withBosyuReactions(find func() (*gemubo.GemuboMessage, bool), fn func(gmsg *gemubo.GemuboMessage)) {
+	var channelId, messageId string
+	var events int
+	manager.withLock(func() {
+		if gmsg, exist := find(); exist {
+			channelId, messageId = gmsg.ChannelId, gmsg.MessgeId
+		}
+		events = manager.reactionEvents
+	})
+	if messageId == "" {
+		return
+	}
+
+	reactions, err := manager.fetchBosyuReactions(channelId, messageId)
+	if err != nil {
+		log.Println("Error getting reaction users\n" + err.Error())
+	}
+
+	manager.withLock(func() {
+		gmsg, exist := find()
+		if !exist {
+			return
+		}
+		//取得している間に届いたリアクションの方が新しいので、その場合は取得した結果を使わない
+		if reactions != nil && manager.reactionEvents == events {
+			manager.applyReactions(gmsg, reactions)
+		}
+		fn(gmsg)
+	})
+}
+
+// 募集中の募集を gemuboId で探す(withBosyuReactions に渡す)
+func (manager *BotManager) activeBosyu(gemuboId string) func() (*gemubo.GemuboMessage, bool) {
+	return func() (*gemubo.GemuboMessage, bool) {
+		gmsg, exist := manager.bosyuMsgs[gemuboId]
+		return gmsg, exist
+	}
+}
+
+// メンションを本文の文字数制限に収まるように複数のメッセージに分割する
+func splitMentions(mentions []string, limit int) []string {
+	contents := make([]string, 0)
+	content := ""
+	for _, mention := range mentions {
+		if content != "" && len(content)+len(mention)+1 > limit {
+			contents = append(contents, content)
+			content = ""
+		}
+		content += mention + " "
+	}
+	if content != "" {
+		contents = append(contents, content)
+	}
+	return contents
+}
+
+// 主催者と定員内の参加者へのメンション
+func participantMentions(gmsg *gemubo.GemuboMessage) []string {
+	mentions := make([]string, 0)
+	mentions = append(mentions, gmsg.Author.Mention())
+	for _, p := range gmsg.ConfirmedParticipants() {
+		if p.UserId == gmsg.Author.ID {
+			continue
+		}
+		mentions = append(mentions, p.Mention())
+	}
+	return mentions
+}
+
+// 未定の人へのメンション(OKも押している人と主催者は除く)
+func maybeMentions(gmsg *gemubo.GemuboMessage) []string {
+	ok := make(map[string]bool)
+	for _, p := range gmsg.ParticipantsByStatus(gemubo.ParticipantOk) {
+		ok[p.UserId] = true
+	}
+
+	mentions := make([]string, 0)
+	for _, p := range gmsg.ParticipantsByStatus(gemubo.ParticipantMaybe) {
+		if ok[p.UserId] || p.UserId == gmsg.Author.ID {
+			continue
+		}
+		mentions = append(mentions, p.Mention())
+	}
+	return mentions
+}
+
+// 募集メッセージへの返信としてメンションを送る(送信はロックを外してから行う)
+func (manager *BotManager) sendMentionReply(gmsg *gemubo.GemuboMessage, mentions []string, embed *discordgo.MessageEmbed) {
+	channelId, messageId := gmsg.ChannelId, gmsg.MessgeId
+	contents := splitMentions(mentions, maxMessageContentLen)
+	manager.afterUnlock(func() {
+		if err := manager.replyMentions(channelId, messageId, contents, embed); err != nil {
+			log.Println("Error sending mention reply\n" + err.Error())
+		}
+	})
+}
+
+// 埋め込みなしでメンションだけを募集メッセージに返信する
+func (manager *BotManager) sendMentionText(gmsg *gemubo.GemuboMessage, mentions []string) {
+	manager.sendMentionReply(gmsg, mentions, nil)
+}
+
+// 1通目に埋め込みを付け、文字数制限に収まらなかったメンションは続けて送信する(embed がnilの場合はメンションだけ)
+func (manager *BotManager) replyMentions(channelId string, messageId string, contents []string, embed *discordgo.MessageEmbed) error {
+	reference := &discordgo.MessageReference{
+		MessageID: messageId,
+	}
+	if embed != nil {
+		first := ""
+		if len(contents) > 0 {
+			first, contents = contents[0], contents[1:]
+		}
+		options := &discordgo.MessageSend{
+			Content:   first,
+			Reference: reference,
+			Embeds:    []*discordgo.MessageEmbed{embed},
+		}
+		if _, err := manager.discord.ChannelMessageSendComplex(channelId, options); err != nil {
+			return err
+		}
+	}
+
+	for _, content := range contents {
+		if _, err := manager.discord.ChannelMessageSendReply(channelId, content, reference); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 参加予定だった人(キャンセル待ちを含む)に募集の中止を知らせる
+func (manager *BotManager) notifyCanceled(gmsg *gemubo.GemuboMessage, title string) {
+	mentions := make([]string, 0)
+	for _, p := range gmsg.ParticipantsByStatus(gemubo.ParticipantOk) {
+		if p.UserId == gmsg.Author.ID {
+			continue
+		}
+		mentions = append(mentions, p.Mention())
+	}
+
+	msg := ""
+	if gmsg.CancelReason != "" {
+		msg = "理由: " + gmsg.CancelReason
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       title,
+		Description: msg,
+		Color:       0x99AAB5,
+	}
+	manager.sendMentionReply(gmsg, mentions, embed)
+}
+
+func remindJobId(gemuboId string, offset time.Duration) string {
+	return fmt.Sprintf("%s/remind/%s", gemuboId, offset)
+}
+
+func formatOffset(offset time.Duration) string {
+	if offset > 0 && offset%time.Hour == 0 {
+		return fmt.Sprintf("%d時間", int(offset.Hours()))
+	}
+	return fmt.Sprintf("%d分", int(offset.Minutes()))
+}
+
+func (manager *BotManager) onBosyuRemind(gmsg *gemubo.GemuboMessage, offset time.Duration) {
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("開始%s前です！", formatOffset(offset)),
+		Description: fmt.Sprintf("開始時刻:%s (%s)", lib.DiscordTimestamp(*gmsg.StartTime, "t"), lib.DiscordTimestamp(*gmsg.StartTime, "R")),
+		Color:       0x00F1AA,
+		Thumbnail: &discordgo.MessageEmbedThumbnail{
+			URL: manager.BotUserInfo.AvatarURL("20"),
+		},
+	}
+
+	mentions := participantMentions(gmsg)
+	if manager.RemindMaybe {
+		mentions = append(mentions, maybeMentions(gmsg)...)
+	}
+	manager.sendMentionReply(gmsg, mentions, embed)
+	manager.saveState()
+}
@@ -0,0 +1,121 @@
+package botmanager
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// 呼ばれた回数を数える reactionLister
+type countingLister struct {
+	*fakeDiscordClient
+	calls int
+}
+
+func (l *countingLister) MessageReactions(channelID, messageID, emojiID string, limit int, beforeID, afterID string, options ...discordgo.RequestOption) ([]*discordgo.User, error) {
+	l.calls++
+	return l.fakeDiscordClient.MessageReactions(channelID, messageID, emojiID, limit, beforeID, afterID, options...)
+}
+
+// Discordのスノーフレークと同じ桁数のIDを持つユーザー
+func manyUsers(n int) []*discordgo.User {
+	users := make([]*discordgo.User, 0, n)
+	for idx := 0; idx < n; idx++ {
+		id := fmt.Sprintf("%d", 400000000000000000+idx)
+		users = append(users, &discordgo.User{ID: id, Username: "user" + id})
+	}
+	return users
+}
+
+func TestFetchReactionUsersPaging(t *testing.T) {
+	for _, n := range []int{0, 1, 99, 100, 101, 250, 300} {
+		discord := newFakeDiscordClient(testBotUser)
+		for _, user := range manyUsers(n) {
+			discord.SimulateReaction("m1", "👍", user)
+		}
+		lister := &countingLister{fakeDiscordClient: discord}
+
+		users, err := fetchReactionUsers(lister, testChannelId, "m1", "👍")
+		if err != nil {
+			t.Fatalf("n=%d: unexpected error %v", n, err)
+		}
+		if len(users) != n {
+			t.Errorf("n=%d: got %d users", n, len(users))
+		}
+		seen := make(map[string]bool)
+		for _, user := range users {
+			if seen[user.ID] {
+				t.Errorf("n=%d: user %s fetched twice", n, user.ID)
+			}
+			seen[user.ID] = true
+		}
+		//ちょうど上限の倍数のときは空のページを確認するまで取得する
+		if want := n/reactionPageLimit + 1; lister.calls != want {
+			t.Errorf("n=%d: %d requests, want %d", n, lister.calls, want)
+		}
+	}
+}
+
+func TestSplitMentions(t *testing.T) {
+	if got := splitMentions(nil, maxMessageContentLen); len(got) != 0 {
+		t.Errorf("splitMentions(nil) = %q, want empty", got)
+	}
+	got := splitMentions([]string{"<@1>", "<@2>", "<@3>"}, 10)
+	want := []string{"<@1> <@2> ", "<@3> "}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("splitMentions = %q, want %q", got, want)
+	}
+}
+
+var mentionPattern = regexp.MustCompile(`<@!?(\d+)>`)
+
+func TestBosyuNotionMentionsManyParticipants(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, testTemplate)
+	b.send(alice, "!gemubo bosyu template=valo $GAMES=valo $START_TIME=+1h")
+	gmsg := b.onlyBosyu()
+
+	//BOTが止まっている間に押されたことにして、開始時にまとめて取得させる
+	users := manyUsers(260)
+	for _, user := range users {
+		b.discord.SimulateReaction(gmsg.MessgeId, b.manager.OkReaction, user)
+	}
+	b.discord.SimulateReaction(gmsg.MessgeId, b.manager.OkReaction, alice)
+
+	before := len(b.discord.Messages)
+	b.clock.Advance(2 * time.Hour)
+	sent := b.discord.Messages[before:]
+	//編集は記録されないので、送信されたのは開始の通知だけ
+	if len(sent) < 2 {
+		t.Fatalf("notice was not split: %d messages", len(sent))
+	}
+	assertContains(t, messageText(sent[0]), "全員しゅうごう～!")
+
+	mentioned := make(map[string]int)
+	for _, msg := range sent {
+		if len(msg.Content) > maxMessageContentLen {
+			t.Errorf("message is %d chars, over the limit", len(msg.Content))
+		}
+		for _, match := range mentionPattern.FindAllStringSubmatch(msg.Content, -1) {
+			mentioned[match[1]]++
+		}
+	}
+
+	for _, user := range users {
+		if mentioned[user.ID] != 1 {
+			t.Errorf("user %s mentioned %d times", user.ID, mentioned[user.ID])
+		}
+	}
+	if mentioned[alice.ID] != 1 {
+		t.Errorf("author mentioned %d times", mentioned[alice.ID])
+	}
+	if mentioned[testBotUser.ID] != 0 {
+		t.Errorf("bot mentioned itself")
+	}
+	if len(mentioned) != len(users)+1 {
+		t.Errorf("%d users mentioned, want %d", len(mentioned), len(users)+1)
+	}
+}
@@ -0,0 +1,133 @@
+package botmanager
+
+import (
+	"gemubobot/gemubo"
+	"gemubobot/store"
+	"log"
+)
+
+func (manager *BotManager) loadState() error {
+	snapshot, err := manager.store.Load()
+	if err != nil {
+		return err
+	}
+
+	migrated := migrateBareVariables(snapshot)
+	for _, template := range snapshot.Templates {
+		manager.guildTemplates(template.GuildId)[template.Name] = template
+	}
+
+	for _, record := range snapshot.Presets {
+		template, exist := manager.guildTemplates(record.TemplateGuildId)[record.TemplateName]
+		if !exist {
+			log.Printf("Skip preset %s: template %s not found", record.Name, record.TemplateName)
+			continue
+		}
+		manager.guildPresets(record.GuildId)[record.Name] = gemubo.NewPreset(record.GuildId, record.Name, template, record.Params)
+	}
+
+	manager.bosyuHistory = append(manager.bosyuHistory, snapshot.BosyuHistory...)
+	for _, gmsg := range snapshot.BosyuMsgs {
+		manager.addGemuboMessage(gmsg)
+	}
+
+	for guildId, tz := range snapshot.GuildTimezones {
+		manager.guildTimezones[guildId] = tz
+	}
+	for userId, tz := range snapshot.UserTimezones {
+		manager.userTimezones[userId] = tz
+	}
+
+	for _, sch := range snapshot.Schedules {
+		manager.addSchedule(sch)
+	}
+
+	log.Printf("Loaded state: %d templates, %d presets, %d bosyu, %d schedules", len(snapshot.Templates), len(snapshot.Presets), len(manager.bosyuMsgs), len(manager.schedules))
+	if migrated {
+		manager.saveState()
+	}
+	return nil
+}
+
+// {} で囲まずに書かれた日本語の変数("$ゲーム")は今の書き方では変数として扱われないので、
+// プリセットや募集で値が指定されている変数名を手がかりに ${ゲーム} に書き換える
+// 書き換えた場合はtrueを返す
+func migrateBareVariables(snapshot *store.Snapshot) bool {
+	names := make([]string, 0)
+	for _, record := range snapshot.Presets {
+		for name := range record.Params {
+			names = append(names, name)
+		}
+	}
+	gmsgs := append(append([]*gemubo.GemuboMessage{}, snapshot.BosyuMsgs...), snapshot.BosyuHistory...)
+	for _, gmsg := range gmsgs {
+		for name := range gmsg.Params {
+			names = append(names, name)
+		}
+	}
+
+	migrated := false
+	for _, template := range snapshot.Templates {
+		content := gemubo.MigrateBareVariables(template.Content, names)
+		if content != template.Content {
+			log.Printf("Migrated template %s: %q -> %q", template.Name, template.Content, content)
+			template.Content = content
+			migrated = true
+		}
+		for _, name := range gemubo.BareNonASCIIVariables(template.Content) {
+			log.Printf("Warning: template %s uses $%s without {} (write ${%s})", template.Name, name, name)
+		}
+	}
+	//編集で本文を作り直すときも同じ書き方になるようにする
+	for _, gmsg := range gmsgs {
+		content := gemubo.MigrateBareVariables(gmsg.TemplateContent, names)
+		if content != gmsg.TemplateContent {
+			gmsg.TemplateContent = content
+			migrated = true
+		}
+	}
+	return migrated
+}
+
+func (manager *BotManager) saveState() {
+	snapshot := store.NewSnapshot()
+
+	for _, templates := range manager.templates {
+		for _, template := range templates {
+			snapshot.Templates = append(snapshot.Templates, template)
+		}
+	}
+
+	for _, presets := range manager.presets {
+		for _, preset := range presets {
+			snapshot.Presets = append(snapshot.Presets, &store.PresetRecord{
+				GuildId:         preset.GuildId,
+				Name:            preset.Name,
+				TemplateGuildId: preset.Template.GuildId,
+				TemplateName:    preset.Template.Name,
+				Params:          preset.Params,
+			})
+		}
+	}
+
+	for _, gmsg := range manager.bosyuMsgs {
+		snapshot.BosyuMsgs = append(snapshot.BosyuMsgs, gmsg)
+	}
+
+	snapshot.BosyuHistory = append(snapshot.BosyuHistory, manager.bosyuHistory...)
+
+	for _, sch := range manager.schedules {
+		snapshot.Schedules = append(snapshot.Schedules, sch)
+	}
+
+	for guildId, tz := range manager.guildTimezones {
+		snapshot.GuildTimezones[guildId] = tz
+	}
+	for userId, tz := range manager.userTimezones {
+		snapshot.UserTimezones[userId] = tz
+	}
+
+	if err := manager.store.Save(snapshot); err != nil {
+		log.Println("Error saving state\n" + err.Error())
+	}
+}
@@ -0,0 +1,49 @@
+package botmanager
+
+import (
+	"testing"
+
+	"gemubobot/gemubo"
+	"gemubobot/scheduler"
+	"gemubobot/store"
+)
+
+func TestLoadStateMigratesBareVariables(t *testing.T) {
+	dataStore := store.NewMemoryStore()
+	snapshot := store.NewSnapshot()
+	snapshot.Templates = append(snapshot.Templates, gemubo.NewTemplate(testGuildId, "old", "$ゲームやる人 @$NUM人"))
+	snapshot.Presets = append(snapshot.Presets, &store.PresetRecord{
+		GuildId:         testGuildId,
+		Name:            "night",
+		TemplateGuildId: testGuildId,
+		TemplateName:    "old",
+		Params:          map[string]string{"$ゲーム": "valo", "$NUM": "3"},
+	})
+	if err := dataStore.Save(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewBotManager(newFakeDiscordClient(testBotUser), dataStore, scheduler.NewFakeClock(testStartTime))
+	template, exist := manager.findTemplate(testGuildId, "old")
+	if !exist {
+		t.Fatalf("template was not loaded")
+	}
+	if want := "${ゲーム}やる人 @$NUM人"; template.Content != want {
+		t.Errorf("Content = %q, want %q", template.Content, want)
+	}
+
+	//書き換えた内容は保存し直される
+	loaded, err := dataStore.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Templates[0].Content != template.Content {
+		t.Errorf("migrated template was not saved: %q", loaded.Templates[0].Content)
+	}
+}
+
+func TestSetTemplateWarnsBareVariables(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, "!gemubo settempl name=jp\n$ゲーム やる人")
+	assertContains(t, b.lastText(), "テンプレート「jp」を登録しました", "日本語の変数名は{}で囲まないと", "$ゲーム → ${ゲーム}")
+}
@@ -0,0 +1,207 @@
+package botmanager
+
+import (
+	"fmt"
+	"gemubobot/gemubo"
+	"gemubobot/lib"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	//人数不足で中止した募集をボタンで延長する時間
+	quorumExtendDuration = 30 * time.Minute
+	//延長ボタンのCustomID(後ろに募集IDが付く)
+	quorumExtendPrefix = "quorum_extend/"
+)
+
+func quorumJobId(gemuboId string) string {
+	return gemuboId + "/quorum"
+}
+
+func (manager *BotManager) onQuorumCheck(gmsg *gemubo.GemuboMessage) {
+	manager.checkQuorum(gmsg)
+}
+
+// 最少人数に届いていない場合は募集を中止してfalseを返す
+// 参加者は呼び出し元が withBosyuReactions で最新にしておく
+func (manager *BotManager) checkQuorum(gmsg *gemubo.GemuboMessage) bool {
+	if gmsg.MinParticipants == 0 {
+		return true
+	}
+	if gmsg.HasQuorum() {
+		gmsg.QuorumChecked = true
+		manager.saveState()
+		return true
+	}
+
+	manager.cancelForQuorum(gmsg)
+	return false
+}
+
+func (manager *BotManager) cancelForQuorum(gmsg *gemubo.GemuboMessage) {
+	gemuboId := gmsg.GemuboId
+	log.Println("Bosyu canceled for quorum : ", gemuboId)
+
+	okCount := len(gmsg.ParticipantsByStatus(gemubo.ParticipantOk))
+	gmsg.Canceled = true
+	gmsg.CancelReason = fmt.Sprintf("人数不足 (参加%d人/最少%d人)", okCount, gmsg.MinParticipants)
+	manager.removeGemuboMessage(gemuboId)
+	manager.saveState()
+
+	//延長したときに参加者が引き継がれるようにリアクションは残しておく
+	manager.refreshBosyuEmbed(gmsg)
+	title := fmt.Sprintf("募集(ID:%s)は人数不足で中止になりました", gemuboId)
+	manager.notifyCanceled(gmsg, title)
+	manager.sendQuorumDM(gmsg, title)
+}
+
+// 主催者に中止を知らせ、延長するボタンを送る
+func (manager *BotManager) sendQuorumDM(gmsg *gemubo.GemuboMessage, title string) {
+	messageLink := fmt.Sprintf("https://discord.com/channels/%s/%s/%s", gmsg.GuildId, gmsg.ChannelId, gmsg.MessgeId)
+	msg := gmsg.CancelReason + "\n" + messageLink + "\n"
+	msg += fmt.Sprintf("もう少し待つ場合は下のボタンで募集を%s延長できます", formatOffset(quorumExtendDuration))
+
+	data := &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       title,
+				Description: msg,
+				Color:       0x99AAB5,
+			},
+		},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    fmt.Sprintf("%s延長する", formatOffset(quorumExtendDuration)),
+						Style:    discordgo.PrimaryButton,
+						CustomID: quorumExtendPrefix + gmsg.GemuboId,
+					},
+				},
+			},
+		},
+	}
+	authorId := gmsg.Author.ID
+	manager.afterUnlock(func() {
+		channel, err := manager.discord.UserChannelCreate(authorId)
+		if err == nil {
+			_, err = manager.discord.ChannelMessageSendComplex(channel.ID, data)
+		}
+		if err != nil {
+			log.Println("Error sending DM to author\n" + err.Error())
+		}
+	})
+}
+
+func (manager *BotManager) onMessageComponent(i *discordgo.InteractionCreate) {
+	customId := i.MessageComponentData().CustomID
+	if gemuboId, found := strings.CutPrefix(customId, quorumExtendPrefix); found {
+		manager.onQuorumExtend(i, gemuboId)
+	}
+}
+
+// 人数不足で中止した募集を開始時刻を遅らせて再開する
+// ロックを取らずに呼ぶ(中止していた間のリアクションをロックの外で取得するため)
+func (manager *BotManager) onQuorumExtend(i *discordgo.InteractionCreate, gemuboId string) {
+	extended := false
+	manager.withLock(func() {
+		extended = manager.extendBosyu(i, gemuboId)
+	})
+	if !extended {
+		return
+	}
+
+	//中止していた間のリアクションも反映してから延長を知らせる
+	manager.withBosyuReactions(manager.activeBosyu(gemuboId), func(gmsg *gemubo.GemuboMessage) {
+		manager.refreshBosyuEmbed(gmsg)
+		manager.saveState()
+
+		embed := &discordgo.MessageEmbed{
+			Title:       fmt.Sprintf("募集(ID:%s)は%s延長されました", gemuboId, formatOffset(quorumExtendDuration)),
+			Description: fmt.Sprintf("開始時刻: %s (%s)", lib.DiscordTimestamp(*gmsg.StartTime, "f"), lib.DiscordTimestamp(*gmsg.StartTime, "R")),
+			Color:       0x00F1AA,
+		}
+		manager.sendMentionReply(gmsg, participantMentions(gmsg), embed)
+	})
+}
+
+// 中止した募集を募集中に戻して開始時刻を遅らせる(延長できた場合はtrue)
+func (manager *BotManager) extendBosyu(i *discordgo.InteractionCreate, gemuboId string) bool {
+	user := i.User
+	if i.Member != nil {
+		user = i.Member.User
+	}
+
+	idx := -1
+	for hidx, gmsg := range manager.bosyuHistory {
+		if gmsg.GemuboId == gemuboId && gmsg.Canceled {
+			idx = hidx
+		}
+	}
+	if idx < 0 {
+		manager.respondComponent(i, "この募集は延長できません", false)
+		return false
+	}
+	gmsg := manager.bosyuHistory[idx]
+	if gmsg.Author.ID != user.ID {
+		manager.respondComponent(i, "募集した人だけが延長できます", false)
+		return false
+	}
+
+	startTime := manager.now()
+	if gmsg.StartTime != nil && gmsg.StartTime.After(startTime) {
+		startTime = *gmsg.StartTime
+	}
+	startTime = startTime.Add(quorumExtendDuration)
+
+	cancelReason := gmsg.CancelReason
+	gmsg.Canceled = false
+	gmsg.CancelReason = ""
+	manager.bosyuHistory = append(manager.bosyuHistory[:idx], manager.bosyuHistory[idx+1:]...)
+	manager.bosyuMsgs[gemuboId] = gmsg
+
+	//postpone と同じく本文の開始時刻も書き換える
+	loc := manager.userLocation(gmsg.GuildId, gmsg.Author.ID)
+	if err := manager.moveBosyuStart(gmsg, startTime, loc); err != nil {
+		log.Println("Error extending bosyu\n" + err.Error())
+		delete(manager.bosyuMsgs, gemuboId)
+		gmsg.Canceled = true
+		gmsg.CancelReason = cancelReason
+		manager.addBosyuHistory(gmsg)
+		manager.saveState()
+		manager.respondComponent(i, "この募集は延長できません", false)
+		return false
+	}
+
+	msg := fmt.Sprintf("募集(ID:%s)を%s延長しました", gemuboId, formatOffset(quorumExtendDuration))
+	manager.respondComponent(i, msg, true)
+	return true
+}
+
+// ボタンへの応答(done の場合はボタンを消して元のメッセージを書き換える)
+func (manager *BotManager) respondComponent(i *discordgo.InteractionCreate, content string, done bool) {
+	resp := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	}
+	if done {
+		resp = &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:    content,
+				Components: []discordgo.MessageComponent{},
+			},
+		}
+	}
+
+	if err := manager.discord.InteractionRespond(i.Interaction, resp); err != nil {
+		log.Println("Error responding interaction\n" + err.Error())
+	}
+}
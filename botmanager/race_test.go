@@ -0,0 +1,108 @@
+package botmanager
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// コマンド・リアクション・スケジューラのジョブを同時に実行しても状態が壊れないことを確かめる
+// データ競合は go test -race で実行したときに検出される
+func TestConcurrentEvents(t *testing.T) {
+	b := newTestBot(t)
+	b.send(alice, testTemplate)
+
+	//リアクションや中止の対象にする募集を先に作っておく
+	targets := make([]string, 0)
+	messageIds := make([]string, 0)
+	for idx := 0; idx < 4; idx++ {
+		b.send(alice, fmt.Sprintf("!gemubo bosyu template=valo $GAMES=game%d $START_TIME=+%dm $REMIND=5m $MIN=1 $MIN_CHECK=10m", idx, 30+idx*20))
+	}
+	b.manager.withLock(func() {
+		for id, gmsg := range b.manager.bosyuMsgs {
+			targets = append(targets, id)
+			messageIds = append(messageIds, gmsg.MessgeId)
+		}
+	})
+
+	var msgSeq int64
+	send := func(author *discordgo.User, content string) {
+		id := atomic.AddInt64(&msgSeq, 1)
+		b.manager.onDiscordMessageCreate(&discordgo.MessageCreate{
+			Message: &discordgo.Message{
+				ID:        fmt.Sprintf("race-%d", id),
+				ChannelID: testChannelId,
+				GuildID:   testGuildId,
+				Author:    author,
+				Content:   content,
+			},
+		})
+	}
+
+	const rounds = 30
+	var wg sync.WaitGroup
+	run := func(fn func(round int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := 0; round < rounds; round++ {
+				fn(round)
+			}
+		}()
+	}
+
+	run(func(round int) {
+		send(bob, fmt.Sprintf("!gemubo settempl name=t%d\n${GAME}やる人 @${NUM:-%d}", round%3, round))
+		if round%4 == 3 {
+			send(bob, fmt.Sprintf("!gemubo remove_templ t%d", round%3))
+		}
+	})
+	run(func(round int) {
+		send(carol, fmt.Sprintf("!gemubo bosyu template=valo $GAMES=new%d $START_TIME=+%dm $REMIND=1m", round, 5+round))
+		send(carol, "!gemubo notions")
+	})
+	run(func(round int) {
+		for _, user := range []*discordgo.User{alice, bob, carol} {
+			messageId := messageIds[(round+len(user.ID))%len(messageIds)]
+			b.react(user, messageId, b.manager.OkReaction)
+			if round%2 == 1 {
+				b.unreact(user, messageId, b.manager.OkReaction)
+			}
+			b.react(user, messageId, b.manager.MaybeReaction)
+		}
+	})
+	run(func(round int) {
+		if round%10 == 9 {
+			send(alice, fmt.Sprintf("!gemubo remove_notion %s reason=都合", targets[round/10]))
+		}
+		send(alice, fmt.Sprintf("!gemubo postpone %s 10m", targets[len(targets)-1]))
+	})
+	run(func(round int) {
+		b.slash(bob, "settempl", "name", "slash", "content", fmt.Sprintf("$GAME %d", round))
+	})
+	run(func(round int) {
+		//リマインド・最少人数の確認・開始のジョブを実行させる
+		b.clock.Advance(2 * time.Minute)
+	})
+	wg.Wait()
+
+	//残りのジョブをすべて実行すると募集中のものはなくなる
+	b.clock.Advance(24 * time.Hour)
+	b.manager.withLock(func() {
+		if len(b.manager.bosyuMsgs) != 0 {
+			t.Errorf("%d bosyu are still active", len(b.manager.bosyuMsgs))
+		}
+		for _, gmsg := range b.manager.bosyuHistory {
+			if _, exist := b.manager.bosyuMsgs[gmsg.GemuboId]; exist {
+				t.Errorf("bosyu %s is both active and in history", gmsg.GemuboId)
+			}
+		}
+	})
+	if _, exist := b.manager.findTemplate(testGuildId, "slash"); !exist {
+		t.Errorf("template registered by slash command was lost")
+	}
+}
@@ -0,0 +1,153 @@
+package botmanager
+
+import (
+	"gemubobot/gemubo"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func (manager *BotManager) findBosyuByMessageId(messageId string) (*gemubo.GemuboMessage, bool) {
+	for _, gmsg := range manager.bosyuMsgs {
+		if gmsg.MessgeId == messageId {
+			return gmsg, true
+		}
+	}
+	return nil, false
+}
+
+func (manager *BotManager) reactionStatus(emoji discordgo.Emoji) (gemubo.ParticipantStatus, bool) {
+	switch emoji.Name {
+	case manager.OkReaction:
+		return gemubo.ParticipantOk, true
+	case manager.NoReaction:
+		return gemubo.ParticipantNo, true
+	}
+	if manager.MaybeReaction != "" && emoji.Name == manager.MaybeReaction {
+		return gemubo.ParticipantMaybe, true
+	}
+	return "", false
+}
+
+// リアクションが続けて押されたときに募集メッセージの更新と保存をまとめる間隔
+const bosyuRefreshDelay = 2 * time.Second
+
+func refreshJobId(gemuboId string) string {
+	return gemuboId + "/refresh"
+}
+
+// 参加状況を反映した募集メッセージに更新する
+func (manager *BotManager) refreshBosyuEmbed(gmsg *gemubo.GemuboMessage) {
+	embed := gemubo.MakeEmbedBosyuMessage(gmsg)
+	channelId, messageId := gmsg.ChannelId, gmsg.MessgeId
+	manager.afterUnlock(func() {
+		_, err := manager.discord.ChannelMessageEditEmbed(channelId, messageId, embed)
+		if err != nil {
+			log.Println("Error editing bosyu message\n" + err.Error())
+		}
+	})
+}
+
+// リアクションのたびに編集と保存をするとレート制限にかかるので、少し待ってからまとめて行う
+func (manager *BotManager) scheduleBosyuRefresh(gemuboId string) {
+	jobId := refreshJobId(gemuboId)
+	if _, exist := manager.scheduler.Scheduled(jobId); exist {
+		return
+	}
+	manager.scheduler.Schedule(jobId, manager.now().Add(bosyuRefreshDelay), func() {
+		manager.withLock(func() {
+			//開始や中止のときはその処理の中で更新と保存をしている
+			if gmsg, exist := manager.bosyuMsgs[gemuboId]; exist {
+				manager.refreshBosyuEmbed(gmsg)
+				manager.saveState()
+			}
+		})
+	})
+}
+
+func (manager *BotManager) onMessageReactionAdd(r *discordgo.MessageReactionAdd) {
+	manager.withLock(func() {
+		manager.applyReactionAdd(r)
+	})
+}
+
+func (manager *BotManager) applyReactionAdd(r *discordgo.MessageReactionAdd) {
+	if manager.BotUserInfo == nil || r.UserID == manager.BotUserInfo.ID {
+		return
+	}
+
+	gmsg, exist := manager.findBosyuByMessageId(r.MessageID)
+	if !exist {
+		return
+	}
+
+	status, ok := manager.reactionStatus(r.Emoji)
+	if !ok {
+		return
+	}
+	manager.reactionEvents++
+
+	if gmsg.AddParticipant(r.UserID, status, manager.now()) {
+		manager.scheduleBosyuRefresh(gmsg.GemuboId)
+	}
+}
+
+func (manager *BotManager) onMessageReactionRemove(r *discordgo.MessageReactionRemove) {
+	manager.withLock(func() {
+		manager.applyReactionRemove(r)
+	})
+}
+
+func (manager *BotManager) applyReactionRemove(r *discordgo.MessageReactionRemove) {
+	if manager.BotUserInfo == nil || r.UserID == manager.BotUserInfo.ID {
+		return
+	}
+
+	gmsg, exist := manager.findBosyuByMessageId(r.MessageID)
+	if !exist {
+		return
+	}
+
+	status, ok := manager.reactionStatus(r.Emoji)
+	if !ok {
+		return
+	}
+	manager.reactionEvents++
+
+	confirmed := gmsg.ConfirmedParticipants()
+	if gmsg.RemoveParticipant(r.UserID, status) {
+		manager.notifyPromoted(gmsg, confirmed)
+		manager.scheduleBosyuRefresh(gmsg.GemuboId)
+	}
+}
+
+// キャンセル待ちから繰り上がった参加者に通知する
+func (manager *BotManager) notifyPromoted(gmsg *gemubo.GemuboMessage, before []*gemubo.Participant) {
+	wasConfirmed := make(map[string]bool)
+	for _, p := range before {
+		wasConfirmed[p.UserId] = true
+	}
+
+	content := ""
+	for _, p := range gmsg.ConfirmedParticipants() {
+		if !wasConfirmed[p.UserId] {
+			content += p.Mention() + " "
+		}
+	}
+	if content == "" {
+		return
+	}
+	content += "\n空きが出たため参加が確定しました！"
+
+	channelId := gmsg.ChannelId
+	reference := &discordgo.MessageReference{
+		MessageID: gmsg.MessgeId,
+	}
+	manager.afterUnlock(func() {
+		_, err := manager.discord.ChannelMessageSendReply(channelId, content, reference)
+		if err != nil {
+			log.Println("Error sending promotion message\n" + err.Error())
+		}
+	})
+}
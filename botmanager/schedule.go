@@ -0,0 +1,162 @@
+package botmanager
+
+import (
+	"fmt"
+	"gemubobot/gemubo"
+	"gemubobot/lib"
+	"log"
+	"time"
+)
+
+const defaultScheduleLead = 30 * time.Minute
+
+func scheduleJobId(scheduleId string) string {
+	return "schedule/" + scheduleId
+}
+
+func (manager *BotManager) addSchedule(sch *gemubo.Schedule) {
+	manager.schedules[sch.Id] = sch
+	manager.planSchedule(sch, manager.now())
+}
+
+func (manager *BotManager) removeSchedule(scheduleId string) {
+	delete(manager.schedules, scheduleId)
+	manager.scheduler.Cancel(scheduleJobId(scheduleId))
+}
+
+// after より後の開催のうち、まだ投稿時刻を過ぎていない最初の回の投稿を予約する
+func (manager *BotManager) planSchedule(sch *gemubo.Schedule, after time.Time) {
+	now := manager.now()
+	for i := 0; i < 100; i++ {
+		occurrence, ok := sch.NextOccurrence(after)
+		if !ok {
+			log.Printf("Schedule %s has no next occurrence", sch.Id)
+			return
+		}
+
+		postTime := occurrence.Add(-sch.Lead)
+		if postTime.Before(now) {
+			after = occurrence
+			continue
+		}
+
+		scheduleId := sch.Id
+		manager.scheduler.Schedule(scheduleJobId(scheduleId), postTime, func() {
+			manager.withLock(func() {
+				manager.runSchedule(scheduleId, occurrence)
+			})
+		})
+		return
+	}
+}
+
+func (manager *BotManager) nextScheduledPost(sch *gemubo.Schedule) (time.Time, bool) {
+	postTime, exist := manager.scheduler.Scheduled(scheduleJobId(sch.Id))
+	if !exist {
+		return time.Time{}, false
+	}
+	return postTime.Add(sch.Lead), true
+}
+
+func (manager *BotManager) runSchedule(scheduleId string, occurrence time.Time) {
+	sch, exist := manager.schedules[scheduleId]
+	if !exist {
+		return
+	}
+	defer manager.planSchedule(sch, occurrence)
+
+	log.Printf("Run schedule %s for %s", sch.Id, occurrence.Format("2006-01-02 15:04 MST"))
+
+	preset, exist := manager.guildPresets(sch.GuildId)[sch.PresetName]
+	if !exist {
+		errmsg := fmt.Sprintf("定期募集(ID:%s)のプリセット「%s」が存在しません", sch.Id, sch.PresetName)
+		manager.SendErrorMessage(sch.ChannelId, "", errmsg, nil)
+		return
+	}
+
+	//本文の$START_TIMEは開始時刻と同じ日付になるように日付も付ける
+	additonalParam := map[string]string{
+		"$START_TIME": occurrence.In(sch.Location()).Format("1/2 15:04"),
+	}
+	gemuboMsg, err := preset.MakeMessage(additonalParam, sch.ChannelId, sch.GuildId, sch.Author, manager.now(), sch.Location())
+	if err != nil {
+		errmsg := fmt.Sprintf("定期募集(ID:%s)の募集を作成できませんでした\n%s", sch.Id, makeMessageErrorText(err))
+		manager.SendErrorMessage(sch.ChannelId, "", errmsg, makeMessageErrorFields(err))
+		return
+	}
+	gemuboMsg.StartTime = &occurrence
+
+	if err := manager.postBosyu(gemuboMsg, "@everyone\n"); err != nil {
+		log.Println("Error sending scheduled bosyu\n" + err.Error())
+		errmsg := fmt.Sprintf("定期募集のメッセージの送信に失敗しました\n(ID:%s)", sch.Id)
+		manager.SendErrorMessage(sch.ChannelId, "", errmsg, nil)
+	}
+}
+
+func onScheduleCommand(arg *CommandArg, manager *BotManager) {
+	params := arg.values
+	title := arg.commandName
+
+	presetName := params["preset"]
+	if _, exist := manager.guildPresets(arg.m.GuildID)[presetName]; !exist {
+		manager.replyError(arg, title, "プリセットが存在しません。", nil)
+		return
+	}
+
+	rule := params["rule"]
+
+	//leadの形式はコマンドの定義で検証済み
+	lead := defaultScheduleLead
+	if leadStr, exist := params["lead"]; exist {
+		lead, _ = time.ParseDuration(leadStr)
+	}
+
+	timezone := manager.timezoneName(arg.m.GuildID, arg.m.Author.ID)
+	sch, err := gemubo.NewSchedule(manager.newScheduleId(), arg.m.GuildID, arg.m.ChannelID, presetName, rule, params["time"], lead, arg.m.Author, timezone)
+	if err != nil {
+		errmsg := fmt.Sprintf("不正な値が指定されています(%s)", err.Error())
+		manager.replyError(arg, title, errmsg, nil)
+		return
+	}
+
+	manager.addSchedule(sch)
+	manager.saveState()
+
+	msg := fmt.Sprintf("定期募集(ID:%s)を登録しました。", sch.Id)
+	if next, exist := manager.nextScheduledPost(sch); exist {
+		msg += fmt.Sprintf("\n次回開始:%s", lib.DiscordTimestamp(next, "F"))
+	}
+	manager.replyNormal(arg, "", msg, nil)
+}
+
+func onSchedulesCommand(arg *CommandArg, manager *BotManager) {
+	msg := ""
+	for _, sch := range manager.schedules {
+		if sch.GuildId != arg.m.GuildID {
+			continue
+		}
+		msg += fmt.Sprintf("-\tID: %s (<#%s>)\n", sch.Id, sch.ChannelId)
+		msg += fmt.Sprintf("\t\t\tプリセット:%s\tルール:%s %s %s\t(%s前に募集)\n", sch.PresetName, sch.Rule, sch.Time, sch.Location().String(), formatOffset(sch.Lead))
+		if next, exist := manager.nextScheduledPost(sch); exist {
+			msg += fmt.Sprintf("\t\t\t次回開始:%s\n", lib.DiscordTimestamp(next, "F"))
+		}
+	}
+	title := "定期募集一覧"
+	manager.replyNormal(arg, title, msg, nil)
+}
+
+func onRemoveSchedule(arg *CommandArg, manager *BotManager) {
+	scheduleId := arg.values["id"]
+	sch, exist := manager.schedules[scheduleId]
+	if !exist || sch.GuildId != arg.m.GuildID {
+		errmsg := "指定されたIDの定期募集は存在しません"
+		title := arg.commandName
+		manager.replyError(arg, title, errmsg, nil)
+		return
+	}
+
+	manager.removeSchedule(scheduleId)
+	manager.saveState()
+	msg := fmt.Sprintf("ID:%sの定期募集を削除しました", scheduleId)
+	manager.replyNormal(arg, "", msg, nil)
+}
@@ -0,0 +1,197 @@
+package botmanager
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func (spec *ArgSpec) applicationCommandOption() *discordgo.ApplicationCommandOption {
+	option := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        spec.Name,
+		Description: spec.Description,
+		Required:    spec.Required,
+		//選択肢が固定の場合は補完を使えない
+		Autocomplete: spec.Complete != completeNone && len(spec.Choices) == 0,
+	}
+	for _, choice := range spec.Choices {
+		option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  choice,
+			Value: choice,
+		})
+	}
+	return option
+}
+
+func (command *Command) applicationCommand() *discordgo.ApplicationCommand {
+	description := command.summary
+	if description == "" {
+		description = command.Name
+	}
+
+	options := make([]*discordgo.ApplicationCommandOption, 0, len(command.args))
+	for _, spec := range command.args {
+		options = append(options, spec.applicationCommandOption())
+	}
+
+	return &discordgo.ApplicationCommand{
+		Name:        command.Name,
+		Description: description,
+		Options:     options,
+	}
+}
+
+func (manager *BotManager) registerSlashCommands() {
+	appCommands := make([]*discordgo.ApplicationCommand, 0, len(manager.commands))
+	for _, command := range manager.commands {
+		if command.textOnly {
+			continue
+		}
+		appCommands = append(appCommands, command.applicationCommand())
+	}
+
+	_, err := manager.discord.ApplicationCommandBulkOverwrite(manager.BotUserInfo.ID, "", appCommands)
+	if err != nil {
+		log.Println("Error registering slash commands\n" + err.Error())
+		return
+	}
+	log.Printf("Registered %d slash commands", len(appCommands))
+}
+
+func (manager *BotManager) onInteractionCreate(i *discordgo.InteractionCreate) {
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		manager.withLock(func() {
+			manager.onAutocomplete(i)
+		})
+		return
+	}
+	if i.Type == discordgo.InteractionMessageComponent {
+		manager.onMessageComponent(i)
+		return
+	}
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	data := i.ApplicationCommandData()
+
+	command, ok := manager.commands[data.Name]
+	if !ok || command.textOnly {
+		log.Println("Invalid slash command: ", data.Name)
+		return
+	}
+
+	values := make(map[string]string)
+	for _, opt := range data.Options {
+		values[opt.Name] = fmt.Sprint(opt.Value)
+	}
+
+	author := i.User
+	if i.Member != nil {
+		author = i.Member.User
+	}
+
+	originalMsg := "/" + command.Name
+	for _, opt := range data.Options {
+		originalMsg += fmt.Sprintf(" %s:%v", opt.Name, opt.Value)
+	}
+
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ChannelID: i.ChannelID,
+			GuildID:   i.GuildID,
+			Author:    author,
+			Content:   originalMsg,
+		},
+	}
+
+	commandArg := NewCommandArg(m, nil, originalMsg, command.Name)
+	commandArg.i = i
+
+	cv, err := command.bindOptions(values)
+	if err != nil {
+		manager.replyError(commandArg, command.Name, err.Error(), nil)
+		return
+	}
+	commandArg.values = cv.values
+	commandArg.variables = cv.variables
+
+	log.Printf("Execute slash command: %s", command.Name)
+	//ロック待ちやAPI呼び出しで3秒を過ぎるとインタラクションが失敗するので、先に応答を保留しておく
+	manager.deferInteraction(commandArg)
+	manager.withLock(func() {
+		command.handler(commandArg, manager)
+	})
+
+	//ハンドラが応答しなかった場合でもインタラクションを完了させる
+	if !commandArg.responded || commandArg.deferred {
+		msg := fmt.Sprintf("「%s」を実行しました", command.Name)
+		manager.respondInteraction(commandArg, msg, nil, true)
+	}
+}
+
+// 「考え中...」と表示させて、返信はあとからフォローアップで送る
+func (manager *BotManager) deferInteraction(arg *CommandArg) {
+	err := manager.discord.InteractionRespond(arg.i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Println("Error deferring interaction\n" + err.Error())
+		return
+	}
+	arg.responded = true
+	arg.deferred = true
+}
+
+func (manager *BotManager) respondInteraction(arg *CommandArg, content string, embeds []*discordgo.MessageEmbed, ephemeral bool) {
+	var flags discordgo.MessageFlags
+	if ephemeral {
+		flags = discordgo.MessageFlagsEphemeral
+	}
+
+	if !arg.responded {
+		arg.responded = true
+		err := manager.discord.InteractionRespond(arg.i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: content,
+				Embeds:  embeds,
+				Flags:   flags,
+			},
+		})
+		if err != nil {
+			log.Println("Error responding interaction\n" + err.Error())
+		}
+		return
+	}
+
+	if arg.deferred {
+		arg.deferred = false
+		//保留した応答は全員に見えるので、自分だけに見せる返信は保留した応答を消してから送る
+		if !ephemeral {
+			edit := &discordgo.WebhookEdit{
+				Content: &content,
+			}
+			if len(embeds) > 0 {
+				edit.Embeds = &embeds
+			}
+			if _, err := manager.discord.InteractionResponseEdit(arg.i.Interaction, edit); err != nil {
+				log.Println("Error editing interaction response\n" + err.Error())
+			}
+			return
+		}
+		if err := manager.discord.InteractionResponseDelete(arg.i.Interaction); err != nil {
+			log.Println("Error deleting interaction response\n" + err.Error())
+		}
+	}
+
+	_, err := manager.discord.FollowupMessageCreate(arg.i.Interaction, true, &discordgo.WebhookParams{
+		Content: content,
+		Embeds:  embeds,
+		Flags:   flags,
+	})
+	if err != nil {
+		log.Println("Error sending followup message\n" + err.Error())
+	}
+}
@@ -0,0 +1,201 @@
+package botmanager
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gemubobot/gemubo"
+	"gemubobot/scheduler"
+	"gemubobot/store"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	testGuildId   = "g1"
+	testChannelId = "c1"
+)
+
+var (
+	testBotUser = &discordgo.User{ID: "1", Username: "gemubo"}
+	alice       = &discordgo.User{ID: "100", Username: "alice"}
+	bob         = &discordgo.User{ID: "200", Username: "bob"}
+	carol       = &discordgo.User{ID: "300", Username: "carol"}
+)
+
+// テストの時計を始める時刻(日本時間の 2026/4/1 12:00)
+var testStartTime = time.Date(2026, 4, 1, 3, 0, 0, 0, time.UTC)
+
+// fakeDiscordClient と FakeClock につないだ BotManager
+type testBot struct {
+	t       *testing.T
+	manager *BotManager
+	discord *fakeDiscordClient
+	clock   *scheduler.FakeClock
+	store   *store.MemoryStore
+}
+
+func newTestBot(t *testing.T) *testBot {
+	t.Helper()
+	clock := scheduler.NewFakeClock(testStartTime)
+	discord := newFakeDiscordClient(testBotUser)
+	dataStore := store.NewMemoryStore()
+	manager := NewBotManager(discord, dataStore, clock)
+	manager.Start(testBotUser)
+	return &testBot{
+		t:       t,
+		manager: manager,
+		discord: discord,
+		clock:   clock,
+		store:   dataStore,
+	}
+}
+
+// !gemuboコマンドを送信し、その間にBOTが送ったメッセージを返す
+func (b *testBot) send(author *discordgo.User, content string) []*discordgo.Message {
+	return b.sendReply(author, content, "")
+}
+
+// replyTo のメッセージへの返信としてコマンドを送信する
+func (b *testBot) sendReply(author *discordgo.User, content string, replyTo string) []*discordgo.Message {
+	return b.sendMessage(testGuildId, author, content, replyTo)
+}
+
+// 別のサーバーからコマンドを送信する
+func (b *testBot) sendInGuild(guildId string, author *discordgo.User, content string) []*discordgo.Message {
+	return b.sendMessage(guildId, author, content, "")
+}
+
+func (b *testBot) sendMessage(guildId string, author *discordgo.User, content string, replyTo string) []*discordgo.Message {
+	b.t.Helper()
+	before := len(b.discord.Messages)
+	m := &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ID:        fmt.Sprintf("cmd-%d", before),
+			ChannelID: testChannelId,
+			GuildID:   guildId,
+			Author:    author,
+			Content:   content,
+		},
+	}
+	if replyTo != "" {
+		m.MessageReference = &discordgo.MessageReference{MessageID: replyTo}
+	}
+	b.manager.onDiscordMessageCreate(m)
+	return b.discord.Messages[before:]
+}
+
+// スラッシュコマンドを実行する(options は名前と値を交互に並べる)
+func (b *testBot) slash(author *discordgo.User, name string, options ...string) {
+	opts := make([]*discordgo.ApplicationCommandInteractionDataOption, 0)
+	for idx := 0; idx+1 < len(options); idx += 2 {
+		opts = append(opts, &discordgo.ApplicationCommandInteractionDataOption{
+			Name:  options[idx],
+			Type:  discordgo.ApplicationCommandOptionString,
+			Value: options[idx+1],
+		})
+	}
+	b.manager.onInteractionCreate(&discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			Type:      discordgo.InteractionApplicationCommand,
+			GuildID:   testGuildId,
+			ChannelID: testChannelId,
+			Member:    &discordgo.Member{User: author},
+			Data: discordgo.ApplicationCommandInteractionData{
+				Name:    name,
+				Options: opts,
+			},
+		},
+	})
+}
+
+// 最後に送られたメッセージの文章(埋め込みを含む)
+func (b *testBot) lastText() string {
+	b.t.Helper()
+	msg := b.discord.LastMessage()
+	if msg == nil {
+		b.t.Fatalf("no message was sent")
+	}
+	return messageText(msg)
+}
+
+func (b *testBot) react(user *discordgo.User, messageId string, emoji string) {
+	b.discord.SimulateReaction(messageId, emoji, user)
+	b.manager.onMessageReactionAdd(&discordgo.MessageReactionAdd{
+		MessageReaction: &discordgo.MessageReaction{
+			UserID:    user.ID,
+			MessageID: messageId,
+			ChannelID: testChannelId,
+			GuildID:   testGuildId,
+			Emoji:     discordgo.Emoji{Name: emoji},
+		},
+	})
+}
+
+func (b *testBot) unreact(user *discordgo.User, messageId string, emoji string) {
+	b.discord.SimulateReactionRemove(messageId, emoji, user)
+	b.manager.onMessageReactionRemove(&discordgo.MessageReactionRemove{
+		MessageReaction: &discordgo.MessageReaction{
+			UserID:    user.ID,
+			MessageID: messageId,
+			ChannelID: testChannelId,
+			GuildID:   testGuildId,
+			Emoji:     discordgo.Emoji{Name: emoji},
+		},
+	})
+}
+
+// 募集中の募集が1つだけであることを確かめて返す
+func (b *testBot) onlyBosyu() *gemubo.GemuboMessage {
+	b.t.Helper()
+	var found *gemubo.GemuboMessage
+	b.manager.withLock(func() {
+		if len(b.manager.bosyuMsgs) != 1 {
+			b.t.Fatalf("%d active bosyu, want 1", len(b.manager.bosyuMsgs))
+		}
+		for _, gmsg := range b.manager.bosyuMsgs {
+			found = gmsg
+		}
+	})
+	return found
+}
+
+func (b *testBot) bosyuEmbed(gmsg *gemubo.GemuboMessage) *discordgo.MessageEmbed {
+	b.t.Helper()
+	msg, exist := b.discord.Message(gmsg.MessgeId)
+	if !exist || len(msg.Embeds) == 0 {
+		b.t.Fatalf("bosyu message %s not found", gmsg.MessgeId)
+	}
+	return msg.Embeds[0]
+}
+
+func messageText(msg *discordgo.Message) string {
+	text := msg.Content
+	for _, embed := range msg.Embeds {
+		text += "\n" + embed.Title + "\n" + embed.Description
+		for _, field := range embed.Fields {
+			text += "\n" + field.Name + "\n" + field.Value
+		}
+	}
+	return text
+}
+
+// 送信されたメッセージの本文をまとめる(ロックを外してから送る通知は返信より後になる)
+func messagesText(msgs []*discordgo.Message) string {
+	text := ""
+	for _, msg := range msgs {
+		text += messageText(msg)
+	}
+	return text
+}
+
+func assertContains(t *testing.T, text string, wants ...string) {
+	t.Helper()
+	for _, want := range wants {
+		if !strings.Contains(text, want) {
+			t.Errorf("%q does not contain %q", text, want)
+		}
+	}
+}
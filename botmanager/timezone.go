@@ -0,0 +1,98 @@
+package botmanager
+
+import (
+	"fmt"
+	"gemubobot/gemubo"
+	"time"
+)
+
+// ユーザー・サーバーのどちらにも設定がない場合のタイムゾーン
+const defaultTimezone = "Asia/Tokyo"
+
+func loadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return gemubo.DefaultLocation()
+	}
+	return loc
+}
+
+// ユーザーの設定、サーバーの設定、デフォルトの順にタイムゾーン名を決める
+func (manager *BotManager) timezoneName(guildId string, userId string) string {
+	if tz, exist := manager.userTimezones[userId]; exist {
+		return tz
+	}
+	if tz, exist := manager.guildTimezones[guildId]; exist {
+		return tz
+	}
+	return defaultTimezone
+}
+
+func (manager *BotManager) userLocation(guildId string, userId string) *time.Location {
+	return loadLocation(manager.timezoneName(guildId, userId))
+}
+
+func onTimezoneCommand(arg *CommandArg, manager *BotManager) {
+	userId := arg.m.Author.ID
+
+	tz, exist := arg.values["timezone"]
+	if !exist {
+		tz := manager.timezoneName(arg.m.GuildID, userId)
+		now := manager.now().In(loadLocation(tz))
+		msg := fmt.Sprintf("あなたのタイムゾーンは %s です(現在時刻:%s)", tz, now.Format("2006-01-02 15:04"))
+		manager.replyNormal(arg, "", msg, nil)
+		return
+	}
+
+	if tz == "reset" {
+		delete(manager.userTimezones, userId)
+		manager.saveState()
+		msg := fmt.Sprintf("タイムゾーンの設定を解除しました(%s を使用します)", manager.timezoneName(arg.m.GuildID, userId))
+		manager.replyNormal(arg, "", msg, nil)
+		return
+	}
+
+	if _, err := time.LoadLocation(tz); err != nil {
+		title := arg.commandName
+		errmsg := "タイムゾーン名が不正です(例: Asia/Tokyo, America/Los_Angeles, Europe/London)"
+		manager.replyError(arg, title, errmsg, nil)
+		return
+	}
+
+	manager.userTimezones[userId] = tz
+	manager.saveState()
+	msg := fmt.Sprintf("あなたのタイムゾーンを %s に設定しました", tz)
+	manager.replyNormal(arg, "", msg, nil)
+}
+
+func onGuildTimezoneCommand(arg *CommandArg, manager *BotManager) {
+	tz, exist := arg.values["timezone"]
+	if !exist {
+		tz := defaultTimezone
+		if guildTz, exist := manager.guildTimezones[arg.m.GuildID]; exist {
+			tz = guildTz
+		}
+		msg := fmt.Sprintf("このサーバーのタイムゾーンは %s です", tz)
+		manager.replyNormal(arg, "", msg, nil)
+		return
+	}
+
+	if !manager.canManageGuild(arg) {
+		title := arg.commandName
+		errmsg := "サーバーのタイムゾーンは「サーバー管理」の権限を持つメンバーだけが設定できます"
+		manager.replyError(arg, title, errmsg, nil)
+		return
+	}
+
+	if _, err := time.LoadLocation(tz); err != nil {
+		title := arg.commandName
+		errmsg := "タイムゾーン名が不正です(例: Asia/Tokyo, America/Los_Angeles, Europe/London)"
+		manager.replyError(arg, title, errmsg, nil)
+		return
+	}
+
+	manager.guildTimezones[arg.m.GuildID] = tz
+	manager.saveState()
+	msg := fmt.Sprintf("このサーバーのタイムゾーンを %s に設定しました", tz)
+	manager.replyNormal(arg, "", msg, nil)
+}
@@ -0,0 +1,143 @@
+package botmanager
+
+import (
+	"errors"
+	"strings"
+)
+
+// コマンドの区切り文字(全角スペースは値の一部として扱う)
+func isTokenSeparator(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+}
+
+// スマートフォンでは " が “ ” に変換されることがあるので同じく引用符として扱う
+func closingQuote(r rune) (rune, bool) {
+	switch r {
+	case '"':
+		return '"', true
+	case '“':
+		return '”', true
+	}
+	return 0, false
+}
+
+func unescapeRune(r rune) (rune, bool) {
+	switch r {
+	case 'n':
+		return '\n', true
+	case 't':
+		return '\t', true
+	case '\\', '"', '“', '”', ' ':
+		return r, true
+	}
+	return 0, false
+}
+
+// コマンドを空白で区切る
+//
+//	key="a b"     引用符の中は空白や改行も値に含まれる
+//	\" \\ \n \t   エスケープ(引用符の外では "\ " で空白も書ける)
+//	key=a=b       値に = を含めることもできる
+//
+// firstLine が true の場合は引用符の外の最初の改行までを区切り、残りをそのまま返す
+func tokenizeCommand(text string, firstLine bool) ([]string, string, error) {
+	runes := []rune(text)
+	tokens := make([]string, 0)
+
+	var sb strings.Builder
+	inToken := false
+	var quote rune
+	inQuote := false
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if r == '\\' && i+1 < len(runes) {
+			if escaped, ok := unescapeRune(runes[i+1]); ok {
+				sb.WriteRune(escaped)
+				inToken = true
+				i++
+				continue
+			}
+		}
+
+		if inQuote {
+			if r == quote {
+				inQuote = false
+			} else {
+				sb.WriteRune(r)
+			}
+			continue
+		}
+
+		if closing, ok := closingQuote(r); ok {
+			quote = closing
+			inQuote = true
+			inToken = true
+			continue
+		}
+
+		if isTokenSeparator(r) {
+			if inToken {
+				tokens = append(tokens, sb.String())
+				sb.Reset()
+				inToken = false
+			}
+			if firstLine && r == '\n' {
+				return tokens, string(runes[i+1:]), nil
+			}
+			continue
+		}
+
+		sb.WriteRune(r)
+		inToken = true
+	}
+
+	if inQuote {
+		return nil, "", errors.New("引用符(\")が閉じられていません")
+	}
+	if inToken {
+		tokens = append(tokens, sb.String())
+	}
+	return tokens, "", nil
+}
+
+// 行の先頭か key= の直後が引用符で始まっているか
+func startsWithQuote(line string) bool {
+	if key, value, found := strings.Cut(line, "="); found && !strings.ContainsAny(key, " \t\"“") {
+		line = value
+	}
+	return strings.HasPrefix(line, "\"") || strings.HasPrefix(line, "“")
+}
+
+// 2行目以降の引数を区切る
+// 空白を含めて1行を1つの引数にする(「$GAMES=valo OW」のように書ける)
+// 行の先頭か値が引用符で始まる行は tokenizeCommand と同じく区切る(引用符の中の改行は次の行に続く)
+// 値の途中の引用符や \ はそのまま残す(「$TITLE=今夜の "ランク" 募集」のように書ける)
+func tokenizeBody(text string) ([]string, error) {
+	tokens := make([]string, 0)
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.Trim(lines[i], " \t\r")
+		if line == "" {
+			continue
+		}
+		if !startsWithQuote(line) {
+			tokens = append(tokens, line)
+			continue
+		}
+
+		chunk := lines[i]
+		lineTokens, _, err := tokenizeCommand(chunk, false)
+		for err != nil && i+1 < len(lines) {
+			i++
+			chunk += "\n" + lines[i]
+			lineTokens, _, err = tokenizeCommand(chunk, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, lineTokens...)
+	}
+	return tokens, nil
+}
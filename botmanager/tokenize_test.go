@@ -0,0 +1,82 @@
+package botmanager
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTokenizeBody(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"空", "", []string{}},
+		{"1行に1つ", "$NUM=3\n$START_TIME=20:30", []string{"$NUM=3", "$START_TIME=20:30"}},
+		{"空白を含む値", "$GAMES=valo OW\n", []string{"$GAMES=valo OW"}},
+		{"cronのルール", "rule=cron:0 22 * * 1-5", []string{"rule=cron:0 22 * * 1-5"}},
+		{"前後の空白と空行", "  $A=1 \r\n\n\t$B=2", []string{"$A=1", "$B=2"}},
+		{"全角スペースは残す", "$A=valo　OW", []string{"$A=valo　OW"}},
+		{"引用符を含む行は区切る", `$A="x y" $B=z`, []string{"$A=x y", "$B=z"}},
+		{"引用符の中の改行", "$A=\"1行目\n2行目\"\n$B=2", []string{"$A=1行目\n2行目", "$B=2"}},
+		{"値の途中の引用符は残す", `$TITLE=今夜の "ランク" 募集`, []string{`$TITLE=今夜の "ランク" 募集`}},
+		{"値の途中の\\は残す", `$PATH=C:\games x`, []string{`$PATH=C:\games x`}},
+		{"全角の引用符で始まる値", "$A=“x y”", []string{"$A=x y"}},
+		{"引用符で始まる行", `"$A=x y" $B=z`, []string{"$A=x y", "$B=z"}},
+	}
+
+	for _, tt := range tests {
+		got, err := tokenizeBody(tt.text)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: tokenizeBody(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+
+	if _, err := tokenizeBody("$A=\"閉じていない\n$B=2"); err == nil {
+		t.Errorf("unclosed quote: expected error")
+	}
+}
+
+// 値を引用符で囲んで1つの引数にする
+func quoteToken(token string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(token)
+	return `"` + escaped + `"`
+}
+
+func FuzzTokenizeCommand(f *testing.F) {
+	f.Add("!gemubo bosyu preset=pre1", "$GAMES=valo OW")
+	f.Add(`$A="x y"`, "a\nb")
+	f.Add("“スマホ”", "\\ \" \t\n")
+	f.Add("", "　全角スペース")
+	f.Add("\"閉じていない", "key=a=b")
+
+	f.Fuzz(func(t *testing.T, a string, b string) {
+		//どんな入力でもパニックしない
+		for _, text := range []string{a, b, a + "\n" + b} {
+			tokenizeCommand(text, true)
+			tokenizeCommand(text, false)
+			tokenizeBody(text)
+		}
+
+		if !utf8.ValidString(a) || !utf8.ValidString(b) {
+			return
+		}
+
+		//引用符で囲んだ値はそのまま戻る
+		want := []string{a, b}
+		text := quoteToken(a) + " " + quoteToken(b)
+		got, rest, err := tokenizeCommand(text, true)
+		if err != nil {
+			t.Fatalf("tokenizeCommand(%q) error: %v", text, err)
+		}
+		if rest != "" || !reflect.DeepEqual(got, want) {
+			t.Fatalf("tokenizeCommand(%q) = %q, %q, want %q", text, got, rest, want)
+		}
+	})
+}
@@ -12,63 +12,107 @@ import (
 )
 
 type Preset struct {
+	GuildId  string
 	Name     string
 	Template *Template
 	Params   map[string]string
 }
 
 type GemuboMessage struct {
-	Content   string
-	StartTime *time.Time
-	GuildId   string
-	ChannelId string
-	GemuboId  string
-	MessgeId  string
-	Author    *discordgo.User
-	ImageURL  string
-	Title     string
+	Content      string
+	StartTime    *time.Time
+	GuildId      string
+	ChannelId    string
+	GemuboId     string
+	MessgeId     string
+	Author       *discordgo.User
+	ImageURL     string
+	Title        string
+	Participants []*Participant
+	//0の場合は人数制限なし
+	MaxParticipants int
+	//0の場合は最少人数なし
+	MinParticipants int
+	//開始時刻の何分前に最少人数を確認するか(0の場合は開始時刻)
+	QuorumCheckOffset time.Duration
+	//最少人数を確認して足りていた場合はtrue(falseの場合は開始時刻に確認する)
+	QuorumChecked bool
+	//開始時刻の何分前にリマインドするか
+	RemindOffsets []time.Duration
+	//編集時に作り直すためのテンプレートの内容と変数の値
+	TemplateContent string
+	Params          map[string]string
+	//中止された募集は終了後も中止と表示する
+	Canceled     bool
+	CancelReason string
 }
 
-func NewPreset(name string, template *Template, params map[string]string) *Preset {
+func NewPreset(guildId string, name string, template *Template, params map[string]string) *Preset {
 	return &Preset{
+		GuildId:  guildId,
 		Name:     name,
 		Template: template,
 		Params:   params,
 	}
 }
 
-func parseTime(str string) (*time.Time, error) {
-	tokens := strings.Split(str, ":")
-	hour, err := strconv.Atoi(tokens[0])
-	if err != nil {
-		return nil, err
-	}
-
-	minu, err := strconv.Atoi(tokens[1])
+func parseTime(str string, now time.Time, loc *time.Location) (*time.Time, error) {
+	targetTime, err := ParseStartTime(str, now, loc)
 	if err != nil {
 		return nil, err
 	}
+	return &targetTime, nil
+}
 
-	now := time.Now().UTC()
-	nowJapan := now.Add(time.Hour * 9)
+func isNowStartTime(str string) bool {
+	return strings.EqualFold(str, "NOW") || str == "今から"
+}
 
-	targetTime := time.Date(nowJapan.Year(), nowJapan.Month(), nowJapan.Day(), hour, minu, 0, 0, time.UTC)
-	if targetTime.Before(nowJapan) {
-		targetTime = targetTime.Add(time.Hour * 24)
+// "30m,5m" のようなカンマ区切りのリマインド時間を解析する
+func parseRemindOffsets(str string) ([]time.Duration, error) {
+	offsets := make([]time.Duration, 0)
+	for _, token := range strings.Split(str, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		offset, err := time.ParseDuration(token)
+		if err != nil || offset <= 0 {
+			return nil, errors.New("Error: $REMINDは\"30m,5m\"のように指定してください")
+		}
+		offsets = append(offsets, offset)
 	}
-	targetTime = targetTime.Add(time.Hour * -9)
-	return &targetTime, nil
+	return offsets, nil
 }
 
-func (p *Preset) MakeMessage(additonalParam map[string]string, channelId string, guildID string, author *discordgo.User) (*GemuboMessage, error) {
-	msg := p.Template.Content
-
+// プリセットの値を additonalParam で上書きしたもの
+func (p *Preset) mergeParams(additonalParam map[string]string) map[string]string {
 	params := make(map[string]string)
 	for pname, value := range p.Params {
 		params[pname] = value
 	}
-	if additonalParam != nil {
-		for pname, value := range additonalParam {
+	for pname, value := range additonalParam {
+		params[pname] = value
+	}
+	return params
+}
+
+// Template.CheckParams と同じくテンプレートにない変数と値のない変数を返す
+func (p *Preset) CheckParams(additonalParam map[string]string) (unknown []string, unfilled []string) {
+	return p.Template.CheckParams(p.mergeParams(additonalParam))
+}
+
+// now と loc は$START_TIMEを解釈するときの現在時刻とタイムゾーン
+func (p *Preset) MakeMessage(additonalParam map[string]string, channelId string, guildID string, author *discordgo.User, now time.Time, loc *time.Location) (*GemuboMessage, error) {
+	parsed, err := ParseTemplate(p.Template.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	params := p.mergeParams(additonalParam)
+	//テンプレートのデフォルト値も特殊な変数の値として扱う
+	for pname, value := range parsed.Defaults() {
+		if v, exist := params[pname]; !exist || v == "" {
 			params[pname] = value
 		}
 	}
@@ -78,24 +122,41 @@ func (p *Preset) MakeMessage(additonalParam map[string]string, channelId string,
 		StartTime: nil,
 		ChannelId: channelId,
 		MessgeId:  "",
-		GemuboId:  lib.GeneRandomID(),
-		GuildId:   guildID,
-		Author:    author,
-		ImageURL:  "",
-		Title:     "",
+		//IDは投稿時に重複しないものが割り当てられる
+		GemuboId:     "",
+		GuildId:      guildID,
+		Author:       author,
+		ImageURL:     "",
+		Title:        "",
+		Participants: make([]*Participant, 0),
+		//デフォルト値を入れる前の値を覚えておく
+		TemplateContent: p.Template.Content,
+		Params:          p.mergeParams(additonalParam),
 	}
 
 	START_TIME := "$START_TIME"
 	TITLE := "$TITLE"
 	IMAGE_URL := "$IMAGE_URL"
+	MAX := "$MAX"
+	MIN := "$MIN"
+	MIN_CHECK := "$MIN_CHECK"
+	REMIND := "$REMIND"
+
+	//問題のある変数はまとめて返す
+	problems := &ValidationError{}
+	parsed.checkTypes(params, now, loc, problems)
 
 	for pname, value := range params {
+		if problems.has(pname) {
+			continue
+		}
 		switch pname {
 		case START_TIME:
-			if value != "NOW" {
-				t, err := parseTime(value)
+			if !isNowStartTime(value) {
+				t, err := parseTime(value, now, loc)
 				if err != nil {
-					return nil, errors.New("Error: 時間は\"hh:mm\"で指定してください")
+					problems.add(pname, value, err)
+					continue
 				}
 				gmsg.StartTime = t
 			}
@@ -105,10 +166,49 @@ func (p *Preset) MakeMessage(additonalParam map[string]string, channelId string,
 			gmsg.ImageURL = value
 			gmsg.ImageURL = strings.TrimLeft(gmsg.ImageURL, "<")
 			gmsg.ImageURL = strings.TrimRight(gmsg.ImageURL, ">")
+		case MAX:
+			max, err := strconv.Atoi(value)
+			if err != nil || max <= 0 {
+				problems.add(pname, value, errors.New("1以上の整数を指定してください"))
+				continue
+			}
+			gmsg.MaxParticipants = max
+		case MIN:
+			min, err := strconv.Atoi(value)
+			if err != nil || min <= 0 {
+				problems.add(pname, value, errors.New("1以上の整数を指定してください"))
+				continue
+			}
+			gmsg.MinParticipants = min
+		case MIN_CHECK:
+			offset, err := time.ParseDuration(value)
+			if err != nil || offset < 0 {
+				problems.add(pname, value, errors.New("\"30m\"のように開始時刻の何分前に確認するかを指定してください"))
+				continue
+			}
+			gmsg.QuorumCheckOffset = offset
+		case REMIND:
+			offsets, err := parseRemindOffsets(value)
+			if err != nil {
+				problems.add(pname, value, err)
+				continue
+			}
+			gmsg.RemindOffsets = offsets
 		}
+	}
 
-		pstr := pname
-		msg = strings.ReplaceAll(msg, pstr, value)
+	if gmsg.MaxParticipants > 0 && gmsg.MinParticipants > gmsg.MaxParticipants && !problems.has(MIN) {
+		problems.add(MIN, params[MIN], errors.New("$MAX以下の値を指定してください"))
+	}
+
+	if len(problems.Problems) > 0 {
+		problems.sort()
+		return nil, problems
+	}
+
+	msg, err := parsed.Render(params)
+	if err != nil {
+		return nil, err
 	}
 
 	gmsg.Content = msg
@@ -116,6 +216,40 @@ func (p *Preset) MakeMessage(additonalParam map[string]string, channelId string,
 	return gmsg, nil
 }
 
+// 投稿済みの募集の変数の値を updates で上書きして作り直す
+// 募集ID・投稿先・主催者・参加者はそのまま残る
+func (gmsg *GemuboMessage) Edit(updates map[string]string, now time.Time, loc *time.Location) error {
+	if gmsg.TemplateContent == "" {
+		return errors.New("Error: この募集は編集に対応していません")
+	}
+
+	preset := NewPreset(gmsg.GuildId, "", NewTemplate(gmsg.GuildId, "", gmsg.TemplateContent), gmsg.Params)
+	edited, err := preset.MakeMessage(updates, gmsg.ChannelId, gmsg.GuildId, gmsg.Author, now, loc)
+	if err != nil {
+		return err
+	}
+	//"+1h" などの相対的な時刻は解釈し直さずに元の開始時刻のままにする
+	if _, exist := updates["$START_TIME"]; !exist {
+		edited.StartTime = gmsg.StartTime
+	}
+	if edited.StartTime == nil {
+		problems := &ValidationError{}
+		problems.add("$START_TIME", updates["$START_TIME"], errors.New("投稿済みの募集を即時開始にすることはできません"))
+		return problems
+	}
+
+	gmsg.Content = edited.Content
+	gmsg.StartTime = edited.StartTime
+	gmsg.Title = edited.Title
+	gmsg.ImageURL = edited.ImageURL
+	gmsg.MaxParticipants = edited.MaxParticipants
+	gmsg.MinParticipants = edited.MinParticipants
+	gmsg.QuorumCheckOffset = edited.QuorumCheckOffset
+	gmsg.RemindOffsets = edited.RemindOffsets
+	gmsg.Params = edited.Params
+	return nil
+}
+
 func MakeEmbedBosyuMessage(gmsg *GemuboMessage) *discordgo.MessageEmbed {
 
 	msg := ""
@@ -127,9 +261,23 @@ func MakeEmbedBosyuMessage(gmsg *GemuboMessage) *discordgo.MessageEmbed {
 		if text == "" {
 			continue
 		}
+		if gmsg.Canceled {
+			text = "~~" + text + "~~"
+		}
 		msg += "### " + text + "\n"
 	}
 
+	if gmsg.StartTime != nil {
+		startText := fmt.Sprintf("開始: %s (%s)", lib.DiscordTimestamp(*gmsg.StartTime, "F"), lib.DiscordTimestamp(*gmsg.StartTime, "R"))
+		if gmsg.Canceled {
+			startText = "~~" + startText + "~~"
+		}
+		msg += startText + "\n"
+	}
+	if gmsg.Canceled && gmsg.CancelReason != "" {
+		msg += "中止理由: " + gmsg.CancelReason + "\n"
+	}
+
 	embed := &discordgo.MessageEmbed{
 		Title:       gmsg.Title,
 		Description: msg,
@@ -145,9 +293,56 @@ func MakeEmbedBosyuMessage(gmsg *GemuboMessage) *discordgo.MessageEmbed {
 	embeds := []*discordgo.MessageEmbed{embed}
 	embeds = append(embeds, embed)
 
+	//即時開始の募集はリアクションを集計しないので参加者の欄は出さない
+	if gmsg.StartTime != nil {
+		addParticipantFields(embed, gmsg)
+	}
+
 	if embed.Title == "" {
 		embed.Title = fmt.Sprintf("%sがゲムボ！", gmsg.Author.Username)
 	}
+	if gmsg.Canceled {
+		embed.Title = "【中止】" + embed.Title
+		embed.Color = 0x99AAB5
+	} else if gmsg.IsFull() {
+		embed.Title = "【締切】" + embed.Title
+	}
 
 	return embed
 }
+
+func addParticipantFields(embed *discordgo.MessageEmbed, gmsg *GemuboMessage) {
+	okUsers := gmsg.ConfirmedParticipants()
+	noUsers := gmsg.ParticipantsByStatus(ParticipantNo)
+	okFieldName := fmt.Sprintf("参加者 (%d人)", len(okUsers))
+	if gmsg.MaxParticipants > 0 {
+		okFieldName = fmt.Sprintf("参加者 (%d/%d人)", len(okUsers), gmsg.MaxParticipants)
+	}
+	if gmsg.MinParticipants > 0 {
+		okFieldName += fmt.Sprintf(" 最少%d人", gmsg.MinParticipants)
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+		Name:   okFieldName,
+		Value:  ParticipantsFieldValue(okUsers),
+		Inline: true,
+	})
+	if waitUsers := gmsg.WaitlistParticipants(); len(waitUsers) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   fmt.Sprintf("キャンセル待ち (%d人)", len(waitUsers)),
+			Value:  ParticipantsFieldValue(waitUsers),
+			Inline: true,
+		})
+	}
+	if maybeUsers := gmsg.ParticipantsByStatus(ParticipantMaybe); len(maybeUsers) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   fmt.Sprintf("未定 (%d人)", len(maybeUsers)),
+			Value:  ParticipantsFieldValue(maybeUsers),
+			Inline: true,
+		})
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+		Name:   fmt.Sprintf("不参加 (%d人)", len(noUsers)),
+		Value:  ParticipantsFieldValue(noUsers),
+		Inline: true,
+	})
+}
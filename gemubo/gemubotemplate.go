@@ -1,13 +1,63 @@
 package gemubo
 
+import "sort"
+
 type Template struct {
-	Name    string
-	Content string
+	GuildId string
+	//共有テンプレートを登録したサーバー(このサーバーだけが上書き・削除できる)
+	OwnerGuildId string
+	Name         string
+	Content      string
 }
 
-func NewTemplate(name string, content string) *Template {
+func NewTemplate(guildId string, name string, content string) *Template {
 	return &Template{
+		GuildId: guildId,
 		Name:    name,
 		Content: content,
 	}
 }
+
+// 募集メッセージの本文以外にも使われる特殊な変数
+var SpecialVariables = []string{"$START_TIME", "$TITLE", "$IMAGE_URL", "$MAX", "$MIN", "$MIN_CHECK", "$REMIND"}
+
+func IsSpecialVariable(name string) bool {
+	for _, special := range SpecialVariables {
+		if name == special {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Template) Variables() ([]*TemplateVariable, error) {
+	parsed, err := ParseTemplate(t.Content)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.Variables(), nil
+}
+
+// params のうちテンプレートで使われていない変数(unknown)と、
+// 値もデフォルト値もない変数(unfilled)を返す
+func (t *Template) CheckParams(params map[string]string) (unknown []string, unfilled []string) {
+	vars, err := t.Variables()
+	if err != nil {
+		return nil, nil
+	}
+
+	declared := make(map[string]bool)
+	for _, v := range vars {
+		declared[v.Name] = true
+		if value, exist := params[v.Name]; (!exist || value == "") && !v.HasDefault {
+			unfilled = append(unfilled, v.Name)
+		}
+	}
+	for name := range params {
+		if !declared[name] && !IsSpecialVariable(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, unfilled
+}
@@ -0,0 +1,118 @@
+package gemubo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type ParticipantStatus string
+
+const (
+	ParticipantOk ParticipantStatus = "ok"
+	ParticipantNo ParticipantStatus = "no"
+	//来られるか分からない(開始時は別に控えめに通知する)
+	ParticipantMaybe ParticipantStatus = "maybe"
+)
+
+type Participant struct {
+	UserId   string
+	Status   ParticipantStatus
+	JoinedAt time.Time
+}
+
+func (p *Participant) Mention() string {
+	return fmt.Sprintf("<@%s>", p.UserId)
+}
+
+// 同じユーザーが同じ状態で既に登録されている場合は何もしない
+func (gmsg *GemuboMessage) AddParticipant(userId string, status ParticipantStatus, joinedAt time.Time) bool {
+	for _, p := range gmsg.Participants {
+		if p.UserId == userId && p.Status == status {
+			return false
+		}
+	}
+
+	gmsg.Participants = append(gmsg.Participants, &Participant{
+		UserId:   userId,
+		Status:   status,
+		JoinedAt: joinedAt,
+	})
+	return true
+}
+
+func (gmsg *GemuboMessage) RemoveParticipant(userId string, status ParticipantStatus) bool {
+	for idx, p := range gmsg.Participants {
+		if p.UserId == userId && p.Status == status {
+			gmsg.Participants = append(gmsg.Participants[:idx], gmsg.Participants[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// 指定した状態の参加者をリアクションした順に返す
+func (gmsg *GemuboMessage) ParticipantsByStatus(status ParticipantStatus) []*Participant {
+	participants := make([]*Participant, 0)
+	for _, p := range gmsg.Participants {
+		if p.Status == status {
+			participants = append(participants, p)
+		}
+	}
+
+	sort.SliceStable(participants, func(a, b int) bool {
+		return participants[a].JoinedAt.Before(participants[b].JoinedAt)
+	})
+	return participants
+}
+
+// 定員までの参加者(定員がない場合はOKの全員)
+func (gmsg *GemuboMessage) ConfirmedParticipants() []*Participant {
+	okUsers := gmsg.ParticipantsByStatus(ParticipantOk)
+	if gmsg.MaxParticipants > 0 && len(okUsers) > gmsg.MaxParticipants {
+		return okUsers[:gmsg.MaxParticipants]
+	}
+	return okUsers
+}
+
+// 定員を超えてOKした参加者をリアクションした順に返す
+func (gmsg *GemuboMessage) WaitlistParticipants() []*Participant {
+	okUsers := gmsg.ParticipantsByStatus(ParticipantOk)
+	if gmsg.MaxParticipants > 0 && len(okUsers) > gmsg.MaxParticipants {
+		return okUsers[gmsg.MaxParticipants:]
+	}
+	return make([]*Participant, 0)
+}
+
+func (gmsg *GemuboMessage) IsFull() bool {
+	return gmsg.MaxParticipants > 0 && len(gmsg.ParticipantsByStatus(ParticipantOk)) >= gmsg.MaxParticipants
+}
+
+// 最少人数が設定されていない場合は常にtrue
+func (gmsg *GemuboMessage) HasQuorum() bool {
+	return len(gmsg.ParticipantsByStatus(ParticipantOk)) >= gmsg.MinParticipants
+}
+
+// 埋め込みのフィールドに収まる文字数の上限
+const maxFieldValueLen = 1024
+
+// 参加者のメンション一覧(フィールドの文字数制限を超える分は人数のみ表示する)
+func ParticipantsFieldValue(participants []*Participant) string {
+	if len(participants) == 0 {
+		return "-"
+	}
+
+	value := ""
+	for idx, p := range participants {
+		line := p.Mention() + "\n"
+		rest := ""
+		if idx < len(participants)-1 {
+			rest = fmt.Sprintf("他%d人\n", len(participants)-idx-1)
+		}
+		if len(value)+len(line)+len(rest) > maxFieldValueLen {
+			return value + fmt.Sprintf("他%d人\n", len(participants)-idx)
+		}
+		value += line
+	}
+	return value
+}
@@ -0,0 +1,222 @@
+package gemubo
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// タイムゾーンが設定されていない場合は日本時間とみなす
+var jst = time.FixedZone("JST", 9*60*60)
+
+func DefaultLocation() *time.Location {
+	return jst
+}
+
+var weekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	"日": 0, "月": 1, "火": 2, "水": 3, "木": 4, "金": 5, "土": 6,
+}
+
+// Recurrence はcronと同じく分・時・日・月・曜日の組み合わせで繰り返しを表す
+type Recurrence struct {
+	minutes  []int
+	hours    []int
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+	//日と曜日の両方が指定されている場合はcronと同じくどちらかに一致すればよい
+	anyDay bool
+}
+
+const recurrenceFormatMsg = "Error: ruleは daily / weekdays / weekends / mon,wed のような曜日 / cron:<分> <時> <日> <月> <曜日> のいずれかで指定してください"
+
+// rule と "21:00" や "21時半" のような時刻から繰り返しを作る(cron形式の場合は時刻は不要)
+func ParseRecurrence(rule string, timeStr string) (*Recurrence, error) {
+	rule = strings.ToLower(strings.TrimSpace(rule))
+
+	if strings.HasPrefix(rule, "cron:") {
+		return parseCron(strings.TrimPrefix(rule, "cron:"))
+	}
+
+	hour, minu, err := parseClock(timeStr)
+	if err != nil {
+		return nil, err
+	}
+
+	weekdays := make(map[int]bool)
+	switch rule {
+	case "daily":
+		for wd := 0; wd < 7; wd++ {
+			weekdays[wd] = true
+		}
+	case "weekdays":
+		for wd := 1; wd <= 5; wd++ {
+			weekdays[wd] = true
+		}
+	case "weekends":
+		weekdays[0] = true
+		weekdays[6] = true
+	default:
+		for _, name := range strings.Split(rule, ",") {
+			wd, exist := weekdayNames[strings.TrimSpace(name)]
+			if !exist {
+				return nil, errors.New(recurrenceFormatMsg)
+			}
+			weekdays[wd] = true
+		}
+	}
+
+	return &Recurrence{
+		minutes:  []int{minu},
+		hours:    []int{hour},
+		days:     rangeSet(1, 31),
+		months:   rangeSet(1, 12),
+		weekdays: weekdays,
+		anyDay:   false,
+	}, nil
+}
+
+// $START_TIME の時刻と同じ書き方を受け付ける(日付や相対時間は使えない)
+func parseClock(str string) (int, int, error) {
+	hour, minu, err := parseTimeOfDay(fullWidthReplacer.Replace(str))
+	if err != nil {
+		return 0, 0, errors.New("Error: 時刻は\"21:00\" や \"21時半\" のように0:00から23:59の範囲で指定してください")
+	}
+	return hour, minu, nil
+}
+
+func parseCron(expr string) (*Recurrence, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.New(recurrenceFormatMsg)
+	}
+
+	minutes, err := parseCronField(fields[0], 0, 59)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := parseCronField(fields[1], 0, 23)
+	if err != nil {
+		return nil, err
+	}
+	days, err := parseCronField(fields[2], 1, 31)
+	if err != nil {
+		return nil, err
+	}
+	months, err := parseCronField(fields[3], 1, 12)
+	if err != nil {
+		return nil, err
+	}
+	weekdays, err := parseCronField(fields[4], 0, 7)
+	if err != nil {
+		return nil, err
+	}
+	//cronでは7も日曜日を表す
+	if weekdays[7] {
+		weekdays[0] = true
+		delete(weekdays, 7)
+	}
+
+	return &Recurrence{
+		minutes:  sortedKeys(minutes),
+		hours:    sortedKeys(hours),
+		days:     days,
+		months:   months,
+		weekdays: weekdays,
+		anyDay:   fields[2] != "*" && fields[4] != "*",
+	}, nil
+}
+
+// "*", "1-5", "*/15", "1,3,5" のようなcronの1フィールドを解析する
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			s, err := strconv.Atoi(part[idx+1:])
+			if err != nil || s <= 0 {
+				return nil, errors.New(recurrenceFormatMsg)
+			}
+			step = s
+			part = part[:idx]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			v, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, errors.New(recurrenceFormatMsg)
+			}
+			from, to = v, v
+			if len(bounds) == 2 {
+				v, err := strconv.Atoi(bounds[1])
+				if err != nil {
+					return nil, errors.New(recurrenceFormatMsg)
+				}
+				to = v
+			}
+		}
+		if from < min || to > max || from > to {
+			return nil, errors.New(recurrenceFormatMsg)
+		}
+
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func rangeSet(from int, to int) map[int]bool {
+	set := make(map[int]bool)
+	for v := from; v <= to; v++ {
+		set[v] = true
+	}
+	return set
+}
+
+func sortedKeys(set map[int]bool) []int {
+	keys := make([]int, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func (r *Recurrence) matchDay(t time.Time) bool {
+	if !r.months[int(t.Month())] {
+		return false
+	}
+	if r.anyDay {
+		return r.days[t.Day()] || r.weekdays[int(t.Weekday())]
+	}
+	return r.days[t.Day()] && r.weekdays[int(t.Weekday())]
+}
+
+// after より後で loc の時刻として最初に一致する日時を返す(見つからない場合はfalse)
+func (r *Recurrence) Next(after time.Time, loc *time.Location) (time.Time, bool) {
+	local := after.In(loc)
+	date := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	//うるう年の2/29のみのような指定でも見つかるように数年分探す
+	for i := 0; i < 366*5; i++ {
+		day := date.AddDate(0, 0, i)
+		if !r.matchDay(day) {
+			continue
+		}
+		for _, hour := range r.hours {
+			for _, minu := range r.minutes {
+				t := time.Date(day.Year(), day.Month(), day.Day(), hour, minu, 0, 0, loc)
+				if t.After(after) {
+					return t.UTC(), true
+				}
+			}
+		}
+	}
+	return time.Time{}, false
+}
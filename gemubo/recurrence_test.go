@@ -0,0 +1,160 @@
+package gemubo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	//2026/4/1(水) 12:00 の日本時間
+	after := time.Date(2026, 4, 1, 12, 0, 0, 0, jst)
+	at := func(year int, month time.Month, day, hour, minu int) time.Time {
+		return time.Date(year, month, day, hour, minu, 0, 0, jst)
+	}
+
+	tests := []struct {
+		rule    string
+		timeStr string
+		want    time.Time
+	}{
+		{"daily", "21:00", at(2026, 4, 1, 21, 0)},
+		{"daily", "11:00", at(2026, 4, 2, 11, 0)},
+		{"DAILY", "12:00", at(2026, 4, 2, 12, 0)},
+		{"weekdays", "21時半", at(2026, 4, 1, 21, 30)},
+		{"weekends", "10時", at(2026, 4, 4, 10, 0)},
+		{"mon,wed", "9:00", at(2026, 4, 6, 9, 0)},
+		{"土, 日", "20:00", at(2026, 4, 4, 20, 0)},
+		{"sat", "２０：００", at(2026, 4, 4, 20, 0)},
+		{"cron:0 22 * * 1-5", "", at(2026, 4, 1, 22, 0)},
+		{"cron:*/15 12 * * *", "", at(2026, 4, 1, 12, 15)},
+		{"cron:0 0 * * 7", "", at(2026, 4, 5, 0, 0)},
+		//日だけ・曜日だけの指定はその条件だけで決まる
+		{"cron:0 12 13 * *", "", at(2026, 4, 13, 12, 0)},
+		{"cron:0 12 * * 5", "", at(2026, 4, 3, 12, 0)},
+		//日と曜日の両方を指定した場合はどちらかに一致すればよい
+		{"cron:0 12 13 * 5", "", at(2026, 4, 3, 12, 0)},
+		{"cron:0 12 2 * 5", "", at(2026, 4, 2, 12, 0)},
+		{"cron:0 0 29 2 *", "", at(2028, 2, 29, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRecurrence(tt.rule, tt.timeStr)
+		if err != nil {
+			t.Errorf("ParseRecurrence(%q, %q) error: %v", tt.rule, tt.timeStr, err)
+			continue
+		}
+		got, ok := r.Next(after, jst)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("ParseRecurrence(%q, %q).Next = %v, %v, want %v", tt.rule, tt.timeStr, got.In(jst), ok, tt.want)
+		}
+	}
+}
+
+func TestParseRecurrenceErrors(t *testing.T) {
+	tests := []struct {
+		rule    string
+		timeStr string
+		want    string
+	}{
+		{"daily", "", "時刻は"},
+		{"daily", "25:00", "時刻は"},
+		{"daily", "+1h", "時刻は"},
+		{"daily", "明日21:00", "時刻は"},
+		{"sometimes", "21:00", "ruleは"},
+		{"mon,someday", "21:00", "ruleは"},
+		{"cron:0 22 * *", "", "ruleは"},
+		{"cron:60 22 * * *", "", "ruleは"},
+		{"cron:0 22 0 * *", "", "ruleは"},
+		{"cron:0 22 * 13 *", "", "ruleは"},
+		{"cron:0 22 * * 8", "", "ruleは"},
+	}
+	for _, tt := range tests {
+		_, err := ParseRecurrence(tt.rule, tt.timeStr)
+		if err == nil {
+			t.Errorf("ParseRecurrence(%q, %q) expected error", tt.rule, tt.timeStr)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseRecurrence(%q, %q) error %q does not contain %q", tt.rule, tt.timeStr, err.Error(), tt.want)
+		}
+	}
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field string
+		min   int
+		max   int
+		want  []int
+	}{
+		{"*", 0, 6, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"5", 0, 59, []int{5}},
+		{"1,3,5", 0, 59, []int{1, 3, 5}},
+		{"1-5", 0, 6, []int{1, 2, 3, 4, 5}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"*/10", 1, 31, []int{1, 11, 21, 31}},
+		{"1-10/3", 0, 59, []int{1, 4, 7, 10}},
+		{"0-6/2,1", 0, 6, []int{0, 1, 2, 4, 6}},
+		{"7", 0, 7, []int{7}},
+	}
+	for _, tt := range tests {
+		set, err := parseCronField(tt.field, tt.min, tt.max)
+		if err != nil {
+			t.Errorf("parseCronField(%q) error: %v", tt.field, err)
+			continue
+		}
+		if got := sortedKeys(set); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCronField(%q) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+
+	for _, field := range []string{"", "a", "60", "5-1", "*/0", "*/x", "1-", "-1", "1-70"} {
+		if _, err := parseCronField(field, 0, 59); err == nil {
+			t.Errorf("parseCronField(%q) expected error", field)
+		}
+	}
+}
+
+func TestCronSundayAsSeven(t *testing.T) {
+	r, err := ParseRecurrence("cron:0 22 * * 5-7", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]bool{0: true, 5: true, 6: true}
+	if !reflect.DeepEqual(r.weekdays, want) {
+		t.Errorf("weekdays = %v, want %v", r.weekdays, want)
+	}
+}
+
+// 夏時間の切り替えをまたいでも現地の同じ時刻になる
+func TestRecurrenceNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ParseRecurrence("daily", "21:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		after time.Time
+		want  time.Time
+	}{
+		//2026/3/8 に夏時間が始まる(UTC-5 → UTC-4)
+		{time.Date(2026, 3, 7, 22, 0, 0, 0, loc), time.Date(2026, 3, 9, 1, 0, 0, 0, time.UTC)},
+		//2026/11/1 に夏時間が終わる(UTC-4 → UTC-5)
+		{time.Date(2026, 10, 31, 22, 0, 0, 0, loc), time.Date(2026, 11, 2, 2, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, ok := r.Next(tt.after, loc)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("Next(%v) = %v, want %v", tt.after, got, tt.want)
+		}
+		if local := got.In(loc); local.Hour() != 21 || local.Minute() != 0 {
+			t.Errorf("Next(%v) = %v in local time, want 21:00", tt.after, local)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package gemubo
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Schedule はプリセットを使って定期的に募集を行う設定
+type Schedule struct {
+	Id         string
+	GuildId    string
+	ChannelId  string
+	PresetName string
+	Rule       string
+	Time       string
+	//開始時刻のどれだけ前に募集を投稿するか
+	Lead     time.Duration
+	Author   *discordgo.User
+	Timezone string
+}
+
+func NewSchedule(id string, guildId string, channelId string, presetName string, rule string, timeStr string, lead time.Duration, author *discordgo.User, timezone string) (*Schedule, error) {
+	if _, err := ParseRecurrence(rule, timeStr); err != nil {
+		return nil, err
+	}
+
+	return &Schedule{
+		Id:         id,
+		GuildId:    guildId,
+		ChannelId:  channelId,
+		PresetName: presetName,
+		Rule:       rule,
+		Time:       timeStr,
+		Lead:       lead,
+		Author:     author,
+		Timezone:   timezone,
+	}, nil
+}
+
+// 繰り返しの時刻を解釈するタイムゾーン
+func (s *Schedule) Location() *time.Location {
+	if s.Timezone == "" {
+		return jst
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return jst
+	}
+	return loc
+}
+
+// after より後で最初の開催日時を返す
+func (s *Schedule) NextOccurrence(after time.Time) (time.Time, bool) {
+	recurrence, err := ParseRecurrence(s.Rule, s.Time)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return recurrence.Next(after, s.Location())
+}
@@ -0,0 +1,410 @@
+package gemubo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// テンプレートの構文
+//
+//	$NAME / ${NAME}     変数(未指定の場合は空文字)
+//	${NAME:-default}    未指定の場合は default
+//	${NAME:?}           必須(未指定の場合は募集できない)
+//	${NAME:?message}    必須(未指定の場合に message を表示する)
+//	$$                  $そのもの
+//
+// 先頭に "---" で囲んだヘッダーを書くと変数の型を宣言できる(書き方は VarType を参照)
+//
+//	---
+//	$NUM: int 1..10
+//	---
+type templateNode struct {
+	text       string
+	isVariable bool
+	name       string
+	hasDefault bool
+	defaultVal string
+	required   bool
+	message    string
+}
+
+type ParsedTemplate struct {
+	nodes []*templateNode
+	//ヘッダーで宣言された変数の型("$NAME" がキー)
+	types    map[string]*VarType
+	declared []string
+}
+
+const templateHeaderDelimiter = "---"
+
+// 先頭の "---" で囲まれたヘッダーを本文と分ける
+func splitTemplateHeader(content string) ([]string, string, error) {
+	lines := strings.Split(content, "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != templateHeaderDelimiter {
+		return nil, content, nil
+	}
+	for idx := 1; idx < len(lines); idx++ {
+		if strings.TrimSpace(lines[idx]) == templateHeaderDelimiter {
+			return lines[1:idx], strings.Join(lines[idx+1:], "\n"), nil
+		}
+	}
+	return nil, "", errors.New("Error: ヘッダーの終わりの \"---\" がありません")
+}
+
+func parseTemplateHeader(lines []string) (map[string]*VarType, []string, error) {
+	types := make(map[string]*VarType)
+	declared := make([]string, 0)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		idx := strings.Index(line, ":")
+		if idx < 0 || !strings.HasPrefix(line, "$") {
+			return nil, nil, fmt.Errorf("Error: ヘッダーの「%s」は \"$変数名: 型\" の形式で書いてください", line)
+		}
+		name := strings.TrimSpace(line[:idx])
+		for _, r := range name[1:] {
+			if !isVariableRune(r) {
+				return nil, nil, fmt.Errorf("Error: 変数名「%s」に使えない文字が含まれています", name)
+			}
+		}
+		if _, exist := types[name]; exist {
+			return nil, nil, fmt.Errorf("Error: %s の型が複数回宣言されています", name)
+		}
+		vt, err := parseVarType(line[idx+1:])
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error: %s の%s", name, err.Error())
+		}
+		types[name] = vt
+		declared = append(declared, name)
+	}
+	return types, declared, nil
+}
+
+// MissingVariablesError は必須の変数が指定されていない場合のエラー
+type MissingVariablesError struct {
+	Names    []string
+	Messages []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	msg := "Error: 以下の必須の変数が指定されていません"
+	for idx, name := range e.Names {
+		msg += "\n\t・$" + name
+		if e.Messages[idx] != "" {
+			msg += " (" + e.Messages[idx] + ")"
+		}
+	}
+	return msg
+}
+
+func isVariableRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// "$NUM人" のように日本語が続けて書かれることが多いので、
+// {} で囲まない変数名は半角英数字と_のみとする(日本語の変数名は ${ゲーム} と書く)
+func isBareVariableRune(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// {} で囲まずに日本語の変数名を書いている箇所("$ゲーム" なら "ゲーム")を返す
+// 以前のテンプレートは $ 以降を変数名としてそのまま置換していたので、この書き方が残っている
+// {} がないと変数名の終わりが分からないため、名前は変数名に使える文字が続く限りとする
+func BareNonASCIIVariables(content string) []string {
+	names := make([]string, 0)
+	_, body, err := splitTemplateHeader(content)
+	if err != nil {
+		return names
+	}
+	runes := []rune(body)
+	for i := 0; i+1 < len(runes); i++ {
+		if runes[i] != '$' {
+			continue
+		}
+		if runes[i+1] == '$' {
+			i++
+			continue
+		}
+		if isBareVariableRune(runes[i+1]) || !isVariableRune(runes[i+1]) {
+			continue
+		}
+		j := i + 1
+		for j < len(runes) && isVariableRune(runes[j]) {
+			j++
+		}
+		names = append(names, string(runes[i+1:j]))
+		i = j - 1
+	}
+	return names
+}
+
+// {} で囲まずに書かれた names の変数を ${NAME} の書き方に直す(names は "$NAME" の形式)
+// 日本語を含まない変数名はそのままでも同じ意味なので変更しない
+func MigrateBareVariables(content string, names []string) string {
+	targets := make([]string, 0)
+	for _, name := range names {
+		bare := strings.TrimPrefix(name, "$")
+		if strings.IndexFunc(bare, func(r rune) bool { return !isBareVariableRune(r) }) >= 0 {
+			targets = append(targets, bare)
+		}
+	}
+	//ヘッダーの "$ゲーム: 型" は {} で囲まない
+	_, body, err := splitTemplateHeader(content)
+	if len(targets) == 0 || err != nil {
+		return content
+	}
+	//"$ゲーム" より "$ゲーム名" を先に置き換える
+	sort.Slice(targets, func(a, b int) bool {
+		return len(targets[a]) > len(targets[b])
+	})
+
+	var sb strings.Builder
+	sb.WriteString(content[:len(content)-len(body)])
+	for i := 0; i < len(body); i++ {
+		if body[i] != '$' {
+			sb.WriteByte(body[i])
+			continue
+		}
+		if strings.HasPrefix(body[i:], "$$") {
+			sb.WriteString("$$")
+			i++
+			continue
+		}
+		replaced := false
+		for _, name := range targets {
+			if strings.HasPrefix(body[i+1:], name) {
+				sb.WriteString("${" + name + "}")
+				i += len(name)
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			sb.WriteByte('$')
+		}
+	}
+	return sb.String()
+}
+
+func ParseTemplate(content string) (*ParsedTemplate, error) {
+	header, body, err := splitTemplateHeader(content)
+	if err != nil {
+		return nil, err
+	}
+	types, declared, err := parseTemplateHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	runes := []rune(body)
+	nodes := make([]*templateNode, 0)
+	text := make([]rune, 0)
+
+	flushText := func() {
+		if len(text) > 0 {
+			nodes = append(nodes, &templateNode{text: string(text)})
+			text = make([]rune, 0)
+		}
+	}
+
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '$' || i+1 >= len(runes) {
+			text = append(text, runes[i])
+			continue
+		}
+
+		next := runes[i+1]
+		switch {
+		case next == '$':
+			text = append(text, '$')
+			i++
+		case next == '{':
+			end := -1
+			for j := i + 2; j < len(runes); j++ {
+				if runes[j] == '}' {
+					end = j
+					break
+				}
+			}
+			if end < 0 {
+				return nil, errors.New("Error: ${ に対応する } がありません")
+			}
+			node, err := parseBracedVariable(string(runes[i+2 : end]))
+			if err != nil {
+				return nil, err
+			}
+			flushText()
+			nodes = append(nodes, node)
+			i = end
+		case isBareVariableRune(next):
+			//$NUMBER が $NUM と誤認されないように最長の名前を取る
+			j := i + 1
+			for j < len(runes) && isBareVariableRune(runes[j]) {
+				j++
+			}
+			flushText()
+			nodes = append(nodes, &templateNode{isVariable: true, name: string(runes[i+1 : j])})
+			i = j - 1
+		default:
+			text = append(text, runes[i])
+		}
+	}
+	flushText()
+
+	return &ParsedTemplate{nodes: nodes, types: types, declared: declared}, nil
+}
+
+func parseBracedVariable(body string) (*templateNode, error) {
+	node := &templateNode{isVariable: true}
+
+	name := body
+	if idx := strings.Index(body, ":"); idx >= 0 {
+		name = body[:idx]
+		modifier := body[idx+1:]
+		switch {
+		case strings.HasPrefix(modifier, "-"):
+			node.hasDefault = true
+			node.defaultVal = modifier[1:]
+		case strings.HasPrefix(modifier, "?"):
+			node.required = true
+			node.message = modifier[1:]
+		default:
+			return nil, fmt.Errorf("Error: ${%s} の書き方が不正です(${名前:-デフォルト値} または ${名前:?} で指定してください)", body)
+		}
+	}
+
+	if name == "" {
+		return nil, errors.New("Error: ${} に変数名がありません")
+	}
+	for _, r := range name {
+		if !isVariableRune(r) {
+			return nil, fmt.Errorf("Error: 変数名「%s」に使えない文字が含まれています", name)
+		}
+	}
+	node.name = name
+	return node, nil
+}
+
+// params のキーは "$NAME" の形式
+func (pt *ParsedTemplate) Render(params map[string]string) (string, error) {
+	missing := &MissingVariablesError{}
+	seen := make(map[string]bool)
+
+	var sb strings.Builder
+	for _, node := range pt.nodes {
+		if !node.isVariable {
+			sb.WriteString(node.text)
+			continue
+		}
+
+		value, exist := params["$"+node.name]
+		if exist && value != "" {
+			sb.WriteString(value)
+			continue
+		}
+
+		switch {
+		case node.hasDefault:
+			sb.WriteString(node.defaultVal)
+		case node.required:
+			if !seen[node.name] {
+				seen[node.name] = true
+				missing.Names = append(missing.Names, node.name)
+				missing.Messages = append(missing.Messages, node.message)
+			}
+		}
+	}
+
+	if len(missing.Names) > 0 {
+		return "", missing
+	}
+	return sb.String(), nil
+}
+
+// デフォルト値が指定されている変数("$NAME" の形式)とその値
+func (pt *ParsedTemplate) Defaults() map[string]string {
+	defaults := make(map[string]string)
+	for _, node := range pt.nodes {
+		if node.isVariable && node.hasDefault {
+			if _, exist := defaults["$"+node.name]; !exist {
+				defaults["$"+node.name] = node.defaultVal
+			}
+		}
+	}
+	return defaults
+}
+
+// TemplateVariable はテンプレートで使われている変数の情報
+type TemplateVariable struct {
+	//"$NAME" の形式
+	Name       string
+	HasDefault bool
+	Default    string
+	Required   bool
+	Message    string
+	//型が宣言されていない場合はnil
+	Type *VarType
+}
+
+// 変数の型(宣言されておらず特殊な変数でもない場合はnil)
+func (pt *ParsedTemplate) Type(name string) *VarType {
+	if vt, exist := pt.types[name]; exist {
+		return vt
+	}
+	return builtinVarTypes[name]
+}
+
+// 型が宣言された変数の値を検証して problems に追加する(params のキーは "$NAME" の形式)
+func (pt *ParsedTemplate) checkTypes(params map[string]string, now time.Time, loc *time.Location, problems *ValidationError) {
+	for name, value := range params {
+		vt := pt.Type(name)
+		if vt == nil || value == "" {
+			continue
+		}
+		if err := vt.Validate(value, now, loc); err != nil {
+			problems.add(name, value, err)
+		}
+	}
+}
+
+// テンプレートで使われている変数を出現順に返す(同じ変数は1つにまとめる)
+// 本文で使われていなくてもヘッダーで型が宣言されていれば最後に含める
+func (pt *ParsedTemplate) Variables() []*TemplateVariable {
+	vars := make([]*TemplateVariable, 0)
+	index := make(map[string]*TemplateVariable)
+	for _, node := range pt.nodes {
+		if !node.isVariable {
+			continue
+		}
+		v, exist := index[node.name]
+		if !exist {
+			v = &TemplateVariable{Name: "$" + node.name}
+			index[node.name] = v
+			vars = append(vars, v)
+		}
+		if node.hasDefault && !v.HasDefault {
+			v.HasDefault = true
+			v.Default = node.defaultVal
+		}
+		if node.required && !v.Required {
+			v.Required = true
+			v.Message = node.message
+		}
+	}
+	for _, name := range pt.declared {
+		if _, exist := index[name[1:]]; !exist {
+			index[name[1:]] = &TemplateVariable{Name: name}
+			vars = append(vars, index[name[1:]])
+		}
+	}
+	for _, v := range vars {
+		v.Type = pt.types[v.Name]
+	}
+	return vars
+}
@@ -0,0 +1,169 @@
+package gemubo
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTemplateRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		params  map[string]string
+		want    string
+	}{
+		{"変数なし", "valoやる人", nil, "valoやる人"},
+		{"$NAME", "$GAMEやる人", map[string]string{"$GAME": "valo"}, "valoやる人"},
+		{"${NAME}", "${GAME}やる人", map[string]string{"$GAME": "valo"}, "valoやる人"},
+		{"未指定は空文字", "[$GAME]", nil, "[]"},
+		{"$NUMBERは$NUMと別の変数", "$NUM/$NUMBER", map[string]string{"$NUM": "3", "$NUMBER": "10"}, "3/10"},
+		{"$NUMBERだけ指定", "$NUM/$NUMBER", map[string]string{"$NUMBER": "10"}, "/10"},
+		{"{}で区切る", "${NUM}BER", map[string]string{"$NUM": "3", "$NUMBER": "10"}, "3BER"},
+		{"日本語が続く", "@$NUM人", map[string]string{"$NUM": "3"}, "@3人"},
+		{"日本語の変数名", "${ゲーム}やる人", map[string]string{"$ゲーム": "valo"}, "valoやる人"},
+		{"デフォルト値", "@${NUM:-5}", nil, "@5"},
+		{"デフォルト値を上書き", "@${NUM:-5}", map[string]string{"$NUM": "3"}, "@3"},
+		{"空の値はデフォルト値", "@${NUM:-5}", map[string]string{"$NUM": ""}, "@5"},
+		{"空のデフォルト値", "[${NUM:-}]", nil, "[]"},
+		{"必須を指定", "${X:?ゲーム名}", map[string]string{"$X": "valo"}, "valo"},
+		{"$$", "$$100", nil, "$100"},
+		{"$$の後の変数", "$$$NUM", map[string]string{"$NUM": "3"}, "$3"},
+		{"末尾の$", "100$", nil, "100$"},
+		{"変数でない$", "$ $-", nil, "$ $-"},
+		{"ヘッダー", "---\n$NUM: int 1..10\n---\n@$NUM", map[string]string{"$NUM": "3"}, "@3"},
+	}
+
+	for _, tt := range tests {
+		pt, err := ParseTemplate(tt.content)
+		if err != nil {
+			t.Errorf("%s: ParseTemplate(%q) error: %v", tt.name, tt.content, err)
+			continue
+		}
+		got, err := pt.Render(tt.params)
+		if err != nil {
+			t.Errorf("%s: Render error: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Render(%q) = %q, want %q", tt.name, tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"閉じていない${", "${NUM", "対応する }"},
+		{"閉じていない${と後続の}", "${NUM:-5 人", "対応する }"},
+		{"空の${}", "${}", "変数名がありません"},
+		{"不正な修飾子", "${NUM:5}", "書き方が不正です"},
+		{"使えない文字", "${NU M}", "使えない文字"},
+		{"ヘッダーが閉じていない", "---\n$NUM: int\n本文", "ヘッダーの終わり"},
+		{"ヘッダーの形式", "---\nNUM int\n---\n", "形式で書いてください"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseTemplate(tt.content)
+		if err == nil {
+			t.Errorf("%s: ParseTemplate(%q) expected error", tt.name, tt.content)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %q does not contain %q", tt.name, err.Error(), tt.want)
+		}
+	}
+}
+
+func TestRenderMissingRequired(t *testing.T) {
+	pt, err := ParseTemplate("${X:?ゲーム名}と${Y:?}と${X:?}")
+	if err != nil {
+		t.Fatalf("ParseTemplate error: %v", err)
+	}
+
+	_, err = pt.Render(map[string]string{"$X": ""})
+	var missing *MissingVariablesError
+	if !errors.As(err, &missing) {
+		t.Fatalf("Render error = %v, want MissingVariablesError", err)
+	}
+	//同じ変数は1回だけ、最初のメッセージで報告する
+	if want := []string{"X", "Y"}; !reflect.DeepEqual(missing.Names, want) {
+		t.Errorf("Names = %q, want %q", missing.Names, want)
+	}
+	if want := []string{"ゲーム名", ""}; !reflect.DeepEqual(missing.Messages, want) {
+		t.Errorf("Messages = %q, want %q", missing.Messages, want)
+	}
+	if !strings.Contains(err.Error(), "$X (ゲーム名)") {
+		t.Errorf("error message %q does not contain the hint", err.Error())
+	}
+}
+
+func TestTemplateVariables(t *testing.T) {
+	pt, err := ParseTemplate("---\n$LEVEL: enum 初心者|上級者\n---\n$GAME ${NUM:-5} ${GAME:?} $NUMBER")
+	if err != nil {
+		t.Fatalf("ParseTemplate error: %v", err)
+	}
+
+	names := make([]string, 0)
+	for _, v := range pt.Variables() {
+		names = append(names, v.Name)
+	}
+	if want := []string{"$GAME", "$NUM", "$NUMBER", "$LEVEL"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Variables = %q, want %q", names, want)
+	}
+	if want := map[string]string{"$NUM": "5"}; !reflect.DeepEqual(pt.Defaults(), want) {
+		t.Errorf("Defaults = %v, want %v", pt.Defaults(), want)
+	}
+}
+
+func TestBareNonASCIIVariables(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"$GAMESやる人 @$NUM人", []string{}},
+		{"${ゲーム}やる人", []string{}},
+		{"$ゲーム やる人 $$円", []string{"ゲーム"}},
+		{"$ゲームやる人", []string{"ゲームやる人"}},
+		{"---\n$ゲーム: string\n---\n${ゲーム}", []string{}},
+	}
+	for _, tt := range tests {
+		if got := BareNonASCIIVariables(tt.content); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("BareNonASCIIVariables(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestMigrateBareVariables(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		names   []string
+		want    string
+	}{
+		{"日本語の変数", "$ゲームやる人 @$NUM人", []string{"$ゲーム", "$NUM"}, "${ゲーム}やる人 @$NUM人"},
+		{"長い名前を優先", "$ゲーム名: $ゲーム", []string{"$ゲーム", "$ゲーム名"}, "${ゲーム名}: ${ゲーム}"},
+		{"値のない変数はそのまま", "$ゲームやる人", []string{"$GAME"}, "$ゲームやる人"},
+		{"$$はそのまま", "$$ゲーム $ゲーム", []string{"$ゲーム"}, "$$ゲーム ${ゲーム}"},
+		{"ヘッダーはそのまま", "---\n$ゲーム: string\n---\n$ゲーム", []string{"$ゲーム"}, "---\n$ゲーム: string\n---\n${ゲーム}"},
+	}
+	for _, tt := range tests {
+		got := MigrateBareVariables(tt.content, tt.names)
+		if got != tt.want {
+			t.Errorf("%s: MigrateBareVariables(%q) = %q, want %q", tt.name, tt.content, got, tt.want)
+			continue
+		}
+		//書き換えた後は以前の置換と同じ結果になる
+		pt, err := ParseTemplate(got)
+		if err != nil {
+			t.Errorf("%s: ParseTemplate(%q) error: %v", tt.name, got, err)
+		}
+		if rendered, _ := pt.Render(map[string]string{"$ゲーム": "valo"}); strings.Contains(tt.want, "${ゲーム}") && !strings.Contains(rendered, "valo") {
+			t.Errorf("%s: %q was not rendered as a variable", tt.name, rendered)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package gemubo
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const startTimeFormatMsg = "Error: 開始時刻は以下のいずれかの形式で指定してください\n" +
+	"\t・20:00 / 20時 / 20時半 / 20時30分\n" +
+	"\t・10/25 21:00 / 2026-10-25 21:00 / 2026-10-25T21:00\n" +
+	"\t・+45m / +1h30m / 45分後 / 1時間30分後\n" +
+	"\t・今日20時 / 明日21:00 / 明後日20時半\n" +
+	"\t・土曜 20:00 / 土曜日20時 / sat 20:00\n" +
+	"\t・NOW (即時開始)"
+
+var (
+	clockPattern        = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+	japaneseTimePattern = regexp.MustCompile(`^(\d{1,2})時(?:(半)|(\d{1,2})分)?$`)
+	datePattern         = regexp.MustCompile(`^(?:(\d{4})[/-])?(\d{1,2})[/-](\d{1,2})(?:T|\s+)(.+)$`)
+	dayWordPattern      = regexp.MustCompile(`^(今日|きょう|明日|あした|明後日|あさって)\s*(.+)$`)
+	weekdayPattern      = regexp.MustCompile(`^(日|月|火|水|木|金|土)(?:曜日|曜)?\s*(.+)$`)
+	enWeekdayPattern    = regexp.MustCompile(`^(sun|mon|tue|wed|thu|fri|sat)[a-z]*\.?\s+(.+)$`)
+)
+
+var dayWordOffsets = map[string]int{
+	"今日": 0, "きょう": 0,
+	"明日": 1, "あした": 1,
+	"明後日": 2, "あさって": 2,
+}
+
+// 全角の数字や記号を半角にそろえる
+var fullWidthReplacer = strings.NewReplacer(
+	"０", "0", "１", "1", "２", "2", "３", "3", "４", "4",
+	"５", "5", "６", "6", "７", "7", "８", "8", "９", "9",
+	"：", ":", "／", "/", "＋", "+", "－", "-", "　", " ",
+)
+
+// ParseStartTime は開始時刻の文字列を解析してUTCの時刻を返す
+// 日付を含まない場合は now 以降で最も近い日時になる
+func ParseStartTime(str string, now time.Time, loc *time.Location) (time.Time, error) {
+	str = strings.TrimSpace(fullWidthReplacer.Replace(str))
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	//相対時間
+	if strings.HasPrefix(str, "+") {
+		d, err := time.ParseDuration(str[1:])
+		if err != nil || d <= 0 {
+			return time.Time{}, errors.New(startTimeFormatMsg)
+		}
+		return now.Add(d).UTC(), nil
+	}
+	if strings.HasSuffix(str, "後") {
+		d, err := parseJapaneseDuration(strings.TrimSuffix(str, "後"))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(d).UTC(), nil
+	}
+
+	//日付の指定
+	if m := datePattern.FindStringSubmatch(str); m != nil {
+		month, _ := strconv.Atoi(m[2])
+		day, _ := strconv.Atoi(m[3])
+		hour, minu, err := parseTimeOfDay(m[4])
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		year := local.Year()
+		if m[1] != "" {
+			year, _ = strconv.Atoi(m[1])
+		}
+		t := time.Date(year, time.Month(month), day, hour, minu, 0, 0, loc)
+		if t.Month() != time.Month(month) || t.Day() != day {
+			return time.Time{}, errors.New("Error: 存在しない日付です")
+		}
+		if t.Before(now) {
+			//年を省略した場合は来年とみなす
+			if m[1] != "" {
+				return time.Time{}, errors.New("Error: 過去の日時は指定できません")
+			}
+			t = t.AddDate(1, 0, 0)
+		}
+		return t.UTC(), nil
+	}
+
+	//今日・明日・明後日
+	if m := dayWordPattern.FindStringSubmatch(str); m != nil {
+		hour, minu, err := parseTimeOfDay(m[2])
+		if err != nil {
+			return time.Time{}, err
+		}
+		date := today.AddDate(0, 0, dayWordOffsets[m[1]])
+		t := time.Date(date.Year(), date.Month(), date.Day(), hour, minu, 0, 0, loc)
+		if t.Before(now) {
+			return time.Time{}, errors.New("Error: 過去の日時は指定できません")
+		}
+		return t.UTC(), nil
+	}
+
+	//曜日
+	weekday, rest, ok := matchWeekday(str)
+	if ok {
+		hour, minu, err := parseTimeOfDay(rest)
+		if err != nil {
+			return time.Time{}, err
+		}
+		diff := (weekday - int(local.Weekday()) + 7) % 7
+		date := today.AddDate(0, 0, diff)
+		t := time.Date(date.Year(), date.Month(), date.Day(), hour, minu, 0, 0, loc)
+		if t.Before(now) {
+			t = t.AddDate(0, 0, 7)
+		}
+		return t.UTC(), nil
+	}
+
+	//時刻のみの場合は今日か明日
+	hour, minu, err := parseTimeOfDay(str)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t := time.Date(today.Year(), today.Month(), today.Day(), hour, minu, 0, 0, loc)
+	if t.Before(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t.UTC(), nil
+}
+
+func matchWeekday(str string) (int, string, bool) {
+	if m := weekdayPattern.FindStringSubmatch(str); m != nil {
+		return weekdayNames[m[1]], m[2], true
+	}
+	if m := enWeekdayPattern.FindStringSubmatch(strings.ToLower(str)); m != nil {
+		return weekdayNames[m[1]], m[2], true
+	}
+	return 0, "", false
+}
+
+// "20:30" / "20時" / "20時半" / "20時30分" を解析する
+func parseTimeOfDay(str string) (int, int, error) {
+	str = strings.TrimSpace(str)
+	hourStr, minuStr := "", "0"
+
+	if m := clockPattern.FindStringSubmatch(str); m != nil {
+		hourStr, minuStr = m[1], m[2]
+	} else if m := japaneseTimePattern.FindStringSubmatch(str); m != nil {
+		hourStr = m[1]
+		if m[2] != "" {
+			minuStr = "30"
+		} else if m[3] != "" {
+			minuStr = m[3]
+		}
+	} else {
+		return 0, 0, errors.New(startTimeFormatMsg)
+	}
+
+	hour, _ := strconv.Atoi(hourStr)
+	minu, _ := strconv.Atoi(minuStr)
+	if hour > 23 || minu > 59 {
+		return 0, 0, errors.New("Error: 時刻は0:00から23:59の範囲で指定してください")
+	}
+	return hour, minu, nil
+}
+
+// "1時間30分" や "1h30m" を解析する
+func parseJapaneseDuration(str string) (time.Duration, error) {
+	replacer := strings.NewReplacer("時間", "h", "分", "m", "秒", "s")
+	d, err := time.ParseDuration(replacer.Replace(strings.TrimSpace(str)))
+	if err != nil || d <= 0 {
+		return 0, errors.New(startTimeFormatMsg)
+	}
+	return d, nil
+}
@@ -0,0 +1,93 @@
+package gemubo
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStartTime(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//2026/12/31(木) 22:00 の日本時間
+	now := time.Date(2026, 12, 31, 22, 0, 0, 0, loc)
+	at := func(year int, month time.Month, day, hour, minu int) time.Time {
+		return time.Date(year, month, day, hour, minu, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name string
+		str  string
+		want time.Time
+	}{
+		{"時刻", "23:00", at(2026, 12, 31, 23, 0)},
+		{"過ぎた時刻は翌日(年をまたぐ)", "21:00", at(2027, 1, 1, 21, 0)},
+		{"今の時刻はそのまま", "22:00", at(2026, 12, 31, 22, 0)},
+		{"時", "23時", at(2026, 12, 31, 23, 0)},
+		{"時半", "22時半", at(2026, 12, 31, 22, 30)},
+		{"時分", "22時15分", at(2026, 12, 31, 22, 15)},
+		{"全角の数字", "２３：３０", at(2026, 12, 31, 23, 30)},
+		{"全角の時半", "２２時半", at(2026, 12, 31, 22, 30)},
+		{"相対時間", "+1h30m", at(2026, 12, 31, 23, 30)},
+		{"全角の相対時間", "＋45m", at(2026, 12, 31, 22, 45)},
+		{"日本語の相対時間", "1時間30分後", at(2026, 12, 31, 23, 30)},
+		{"月日", "12/31 23:30", at(2026, 12, 31, 23, 30)},
+		{"年を省略した過去の月日は来年", "1/1 9:00", at(2027, 1, 1, 9, 0)},
+		{"年月日", "2027-01-02 20:00", at(2027, 1, 2, 20, 0)},
+		{"年月日T", "2027-01-02T20時半", at(2027, 1, 2, 20, 30)},
+		{"今日", "今日23時", at(2026, 12, 31, 23, 0)},
+		{"明日", "明日21:00", at(2027, 1, 1, 21, 0)},
+		{"明後日", "あさって 20時半", at(2027, 1, 2, 20, 30)},
+		{"今日の曜日", "木曜 23:00", at(2026, 12, 31, 23, 0)},
+		{"過ぎた今日の曜日は来週", "木曜日21時", at(2027, 1, 7, 21, 0)},
+		{"次の曜日", "土曜日20時", at(2027, 1, 2, 20, 0)},
+		{"曜日が前に戻る", "水 20:00", at(2027, 1, 6, 20, 0)},
+		{"英語の曜日", "Sat 20:00", at(2027, 1, 2, 20, 0)},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseStartTime(tt.str, now.UTC(), loc)
+		if err != nil {
+			t.Errorf("%s: ParseStartTime(%q) error: %v", tt.name, tt.str, err)
+			continue
+		}
+		if !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("%s: ParseStartTime(%q) = %v, want %v", tt.name, tt.str, got.In(loc), tt.want)
+		}
+	}
+}
+
+func TestParseStartTimeErrors(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 12, 31, 22, 0, 0, 0, loc)
+
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{"年を指定した過去の日付", "2026-12-30 20:00", "過去の日時"},
+		{"過ぎた今日の時刻", "今日20時", "過去の日時"},
+		{"存在しない日付", "2/30 20:00", "存在しない日付"},
+		{"範囲外の時刻", "25:00", "0:00から23:59"},
+		{"範囲外の分", "20時60分", "0:00から23:59"},
+		{"0の相対時間", "+0m", "開始時刻は以下"},
+		{"解釈できない", "きのう", "開始時刻は以下"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseStartTime(tt.str, now, loc)
+		if err == nil {
+			t.Errorf("%s: ParseStartTime(%q) expected error", tt.name, tt.str)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %q does not contain %q", tt.name, err.Error(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package gemubo
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// テンプレートのヘッダーで宣言できる変数の型
+//
+//	$NUM: int 1..10
+//	$GAME: enum valo|apex|ow
+//	$DAY: time
+//	$LINK: url
+//	$HOST: user
+//	$TEAM: role
+type VarType struct {
+	Kind    string
+	Min     *int
+	Max     *int
+	Choices []string
+}
+
+const (
+	varKindString = "string"
+	varKindInt    = "int"
+	varKindEnum   = "enum"
+	varKindTime   = "time"
+	varKindURL    = "url"
+	varKindUser   = "user"
+	varKindRole   = "role"
+)
+
+const varTypeFormatMsg = "型は string / int (最小..最大) / enum 選択肢1|選択肢2 / time / url / user / role のいずれかで指定してください"
+
+var (
+	userMentionPattern = regexp.MustCompile(`^<@!?[0-9]+>$`)
+	roleMentionPattern = regexp.MustCompile(`^<@&[0-9]+>$`)
+)
+
+// 特殊な変数は宣言がなくても型を検証する
+var builtinVarTypes = map[string]*VarType{
+	"$IMAGE_URL": {Kind: varKindURL},
+}
+
+func parseVarType(spec string) (*VarType, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, errors.New(varTypeFormatMsg)
+	}
+
+	vt := &VarType{Kind: strings.ToLower(fields[0])}
+	args := strings.Join(fields[1:], "")
+	switch vt.Kind {
+	case varKindInt:
+		if args == "" {
+			break
+		}
+		bounds := strings.SplitN(args, "..", 2)
+		if len(bounds) != 2 {
+			return nil, errors.New("intの範囲は \"1..10\" のように指定してください(\"1..\" や \"..10\" も使えます)")
+		}
+		if bounds[0] != "" {
+			v, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, errors.New("intの範囲は \"1..10\" のように指定してください")
+			}
+			vt.Min = &v
+		}
+		if bounds[1] != "" {
+			v, err := strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, errors.New("intの範囲は \"1..10\" のように指定してください")
+			}
+			vt.Max = &v
+		}
+		if vt.Min != nil && vt.Max != nil && *vt.Min > *vt.Max {
+			return nil, errors.New("intの範囲の最小値が最大値より大きくなっています")
+		}
+	case varKindEnum:
+		for _, choice := range strings.Split(args, "|") {
+			if choice != "" {
+				vt.Choices = append(vt.Choices, choice)
+			}
+		}
+		if len(vt.Choices) == 0 {
+			return nil, errors.New("enumの選択肢は \"valo|apex|ow\" のように指定してください")
+		}
+	case varKindString, varKindTime, varKindURL, varKindUser, varKindRole:
+		if args != "" {
+			return nil, fmt.Errorf("%sには追加の指定はできません", vt.Kind)
+		}
+	default:
+		return nil, errors.New(varTypeFormatMsg)
+	}
+	return vt, nil
+}
+
+// 表示用の型の説明
+func (vt *VarType) String() string {
+	switch vt.Kind {
+	case varKindInt:
+		if vt.Min == nil && vt.Max == nil {
+			return "int"
+		}
+		return "int " + vt.rangeText()
+	case varKindEnum:
+		return "enum " + strings.Join(vt.Choices, "|")
+	}
+	return vt.Kind
+}
+
+// "1..10" のような範囲の表示
+func (vt *VarType) rangeText() string {
+	rangeStr := ""
+	if vt.Min != nil {
+		rangeStr += strconv.Itoa(*vt.Min)
+	}
+	rangeStr += ".."
+	if vt.Max != nil {
+		rangeStr += strconv.Itoa(*vt.Max)
+	}
+	return rangeStr
+}
+
+// 値が型に合っていない場合はその理由を返す(now と loc は時刻の値を解釈するときに使う)
+func (vt *VarType) Validate(value string, now time.Time, loc *time.Location) error {
+	switch vt.Kind {
+	case varKindInt:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("整数で指定してください")
+		}
+		if (vt.Min != nil && v < *vt.Min) || (vt.Max != nil && v > *vt.Max) {
+			return fmt.Errorf("%sの範囲で指定してください", vt.rangeText())
+		}
+	case varKindEnum:
+		for _, choice := range vt.Choices {
+			if value == choice {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s のいずれかを指定してください", strings.Join(vt.Choices, ", "))
+	case varKindTime:
+		if isNowStartTime(value) {
+			return nil
+		}
+		if _, err := ParseStartTime(value, now, loc); err != nil {
+			return errors.New(strings.TrimPrefix(err.Error(), "Error: "))
+		}
+	case varKindURL:
+		u, err := url.Parse(strings.Trim(value, "<>"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("http:// または https:// で始まるURLを指定してください")
+		}
+	case varKindUser:
+		if !userMentionPattern.MatchString(value) {
+			return errors.New("ユーザーのメンション(@ユーザー名)を指定してください")
+		}
+	case varKindRole:
+		if !roleMentionPattern.MatchString(value) {
+			return errors.New("ロールのメンション(@ロール名)を指定してください")
+		}
+	}
+	return nil
+}
+
+// VariableProblem は1つの変数の値についての問題
+type VariableProblem struct {
+	//"$NAME" の形式
+	Name    string
+	Value   string
+	Message string
+}
+
+// ValidationError は変数の値が不正な場合のエラー(問題のあった変数ごとにまとめる)
+type ValidationError struct {
+	Problems []*VariableProblem
+}
+
+func (e *ValidationError) Error() string {
+	msg := "Error: 変数の値が不正です"
+	for _, problem := range e.Problems {
+		msg += fmt.Sprintf("\n\t・%s=%s: %s", problem.Name, problem.Value, problem.Message)
+	}
+	return msg
+}
+
+func (e *ValidationError) add(name string, value string, err error) {
+	e.Problems = append(e.Problems, &VariableProblem{
+		Name:    name,
+		Value:   value,
+		Message: strings.TrimPrefix(err.Error(), "Error: "),
+	})
+}
+
+func (e *ValidationError) has(name string) bool {
+	for _, problem := range e.Problems {
+		if problem.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *ValidationError) sort() {
+	sort.SliceStable(e.Problems, func(i, j int) bool {
+		return e.Problems[i].Name < e.Problems[j].Name
+	})
+}
@@ -0,0 +1,153 @@
+package gemubo
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseVarType(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"string", "string"},
+		{" INT ", "int"},
+		{"int 1..10", "int 1..10"},
+		{"int 1 .. 10", "int 1..10"},
+		{"int 1..", "int 1.."},
+		{"int ..10", "int ..10"},
+		{"int -5..-1", "int -5..-1"},
+		{"int 3..3", "int 3..3"},
+		{"enum valo|apex|ow", "enum valo|apex|ow"},
+		{"enum |valo||apex|", "enum valo|apex"},
+		{"time", "time"},
+		{"url", "url"},
+		{"user", "user"},
+		{"role", "role"},
+	}
+	for _, tt := range tests {
+		vt, err := parseVarType(tt.spec)
+		if err != nil {
+			t.Errorf("parseVarType(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if got := vt.String(); got != tt.want {
+			t.Errorf("parseVarType(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseVarTypeErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"", "型は"},
+		{"float", "型は"},
+		{"int 10", "のように指定してください"},
+		{"int a..10", "のように指定してください"},
+		{"int 1..b", "のように指定してください"},
+		{"int 10..1", "最小値が最大値より大きく"},
+		{"enum", "enumの選択肢"},
+		{"enum ||", "enumの選択肢"},
+		{"url https", "追加の指定はできません"},
+	}
+	for _, tt := range tests {
+		_, err := parseVarType(tt.spec)
+		if err == nil {
+			t.Errorf("parseVarType(%q) expected error", tt.spec)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseVarType(%q) error %q does not contain %q", tt.spec, err.Error(), tt.want)
+		}
+	}
+}
+
+func TestVarTypeValidate(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 4, 1, 12, 0, 0, 0, loc)
+
+	tests := []struct {
+		spec  string
+		value string
+		//空の場合は正しい値
+		want string
+	}{
+		{"int 1..10", "1", ""},
+		{"int 1..10", "10", ""},
+		{"int 1..10", "0", "1..10の範囲"},
+		{"int 1..10", "11", "1..10の範囲"},
+		{"int 1..", "1000", ""},
+		{"int 1..", "0", "1..の範囲"},
+		{"int ..10", "-3", ""},
+		{"int ..10", "11", "..10の範囲"},
+		{"int", "三", "整数で"},
+		{"enum valo|apex", "apex", ""},
+		{"enum valo|apex", "APEX", "valo, apex のいずれか"},
+		{"time", "21:00", ""},
+		{"time", "NOW", ""},
+		{"time", "今日11時", "過去の日時"},
+		{"url", "https://example.com/a", ""},
+		{"url", "<https://example.com>", ""},
+		{"url", "example.com", "http:// または https://"},
+		{"url", "ftp://example.com", "http:// または https://"},
+		{"user", "<@123>", ""},
+		{"user", "<@!123>", ""},
+		{"user", "<@&123>", "ユーザーのメンション"},
+		{"user", "@alice", "ユーザーのメンション"},
+		{"role", "<@&456>", ""},
+		{"role", "<@456>", "ロールのメンション"},
+	}
+	for _, tt := range tests {
+		vt, err := parseVarType(tt.spec)
+		if err != nil {
+			t.Fatalf("parseVarType(%q) error: %v", tt.spec, err)
+		}
+		err = vt.Validate(tt.value, now, loc)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: Validate(%q) error: %v", tt.spec, tt.value, err)
+		case tt.want != "" && err == nil:
+			t.Errorf("%s: Validate(%q) expected error", tt.spec, tt.value)
+		case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+			t.Errorf("%s: Validate(%q) error %q does not contain %q", tt.spec, tt.value, err.Error(), tt.want)
+		}
+	}
+}
+
+func TestMakeMessageValidationError(t *testing.T) {
+	content := "---\n$NUM: int 1..10\n$LEVEL: enum 初心者|上級者\n$HOST: user\n---\n$LEVEL $NUM人 $HOST"
+	preset := NewPreset("g1", "", NewTemplate("g1", "t", content), nil)
+	params := map[string]string{
+		"$NUM":   "20",
+		"$LEVEL": "中級者",
+		"$HOST":  "<@100>",
+		"$MAX":   "0",
+	}
+
+	_, err := preset.MakeMessage(params, "c1", "g1", nil, time.Now(), time.UTC)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("MakeMessage error = %v, want ValidationError", err)
+	}
+	//問題のある変数ごとに1つずつ、名前順に並ぶ
+	names := make([]string, 0)
+	for _, problem := range invalid.Problems {
+		names = append(names, problem.Name)
+	}
+	if want := []string{"$LEVEL", "$MAX", "$NUM"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("problems = %q, want %q", names, want)
+	}
+	for _, problem := range invalid.Problems {
+		if problem.Value != params[problem.Name] || problem.Message == "" || strings.HasPrefix(problem.Message, "Error: ") {
+			t.Errorf("problem = %+v", problem)
+		}
+	}
+}
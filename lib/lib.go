@@ -1,15 +1,46 @@
 package lib
 
 import (
+	"crypto/rand"
 	"fmt"
-	"math/rand"
+	"math/big"
+	"strings"
 	"time"
 )
 
+// DiscordTimestamp は閲覧者のローカル時刻で表示されるDiscordのタイムスタンプ記法を返す
+// style は F(日時) / f(短い日時) / t(時刻) / R(相対時間) など
+func DiscordTimestamp(t time.Time, style string) string {
+	return fmt.Sprintf("<t:%d:%s>", t.Unix(), style)
+}
+
+func randomInt(max int64) int64 {
+	n, err := rand.Int(rand.Reader, big.NewInt(max))
+	if err != nil {
+		panic("crypto/rand is unavailable: " + err.Error())
+	}
+	return n.Int64()
+}
+
+// 重複の確認は呼び出し側で行うこと
 func GeneRandomID() string {
-	source := rand.NewSource(time.Now().UnixNano())
-	random := rand.New(source)
+	return fmt.Sprintf("%08d", randomInt(1e8))
+}
+
+// 読み間違えやすい I L O U を除いたCrockfordのbase32
+const codeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// length文字のbase32のコードを作る(重複の確認は呼び出し側で行うこと)
+func GenerateCode(length int) string {
+	var sb strings.Builder
+	for i := 0; i < length; i++ {
+		sb.WriteByte(codeAlphabet[randomInt(int64(len(codeAlphabet)))])
+	}
+	return sb.String()
+}
 
-	i := random.Intn(1e8)
-	return fmt.Sprintf("%08d", i)
+// 入力されたコードを GenerateCode の形式にそろえる(小文字やOと0などの打ち間違いを許す)
+func NormalizeCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("O", "0", "I", "1", "L", "1").Replace(code)
 }
@@ -3,10 +3,13 @@ package main
 import (
 	"fmt"
 	"gemubobot/botmanager"
+	"gemubobot/scheduler"
+	"gemubobot/store"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	_ "time/tzdata"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/joho/godotenv"
@@ -31,15 +34,29 @@ func main() {
 		log.Fatal("Error creating Discord session: ", err)
 	}
 
-	bot := botmanager.NewBotManager(discord)
-	botmanager.SetGlobalManager(bot)
+	dataFile := os.Getenv("GEMUBO_DATA_FILE")
+	if dataFile == "" {
+		dataFile = "gemubo_data.json"
+	}
+
+	bot := botmanager.NewBotManager(discord, store.NewFileStore(dataFile), scheduler.RealClock())
+	//未定のリアクションを変更する場合は GEMUBO_MAYBE_REACTION に絵文字を指定する(none で未定のリアクションを使わない)
+	switch maybeReaction := os.Getenv("GEMUBO_MAYBE_REACTION"); maybeReaction {
+	case "":
+	case "none":
+		bot.MaybeReaction = ""
+	default:
+		bot.MaybeReaction = maybeReaction
+	}
+	bot.RemindMaybe = os.Getenv("GEMUBO_REMIND_MAYBE") == "true"
+	bot.AddHandlers(discord)
 
 	err = discord.Open()
 	if err != nil {
 		log.Fatal("Error opening connection: ", err)
 	}
 	defer discord.Close()
-	bot.Start()
+	bot.Start(discord.State.User)
 
 	fmt.Println("Bot is now running.  Press CTRL-C to exit.")
 	stopBot := make(chan os.Signal, 1)
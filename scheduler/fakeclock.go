@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock は Advance を呼んだときだけ時刻が進む Clock(テスト用)
+// 期限が来たタイマーは Advance を呼んだgoroutineで時刻順に実行される
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *FakeClock
+	at      time.Time
+	fn      func()
+	stopped bool
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := !t.stopped
+	t.stopped = true
+	return active
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:    now,
+		timers: make([]*fakeTimer, 0),
+	}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{
+		clock: c,
+		at:    c.now.Add(d),
+		fn:    f,
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// 時刻を d だけ進め、その間に期限が来たタイマーを実行する(d が0の場合は期限切れのものだけ)
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		next := c.nextTimer(target)
+		if next == nil {
+			c.now = target
+			c.mu.Unlock()
+			return
+		}
+		next.stopped = true
+		if next.at.After(c.now) {
+			c.now = next.at
+		}
+		c.mu.Unlock()
+
+		next.fn()
+	}
+}
+
+// target までに期限が来る最も早いタイマー(止まったタイマーはここで捨てる)
+func (c *FakeClock) nextTimer(target time.Time) *fakeTimer {
+	var next *fakeTimer
+	active := c.timers[:0]
+	for _, t := range c.timers {
+		if t.stopped {
+			continue
+		}
+		active = append(active, t)
+		if t.at.After(target) {
+			continue
+		}
+		if next == nil || t.at.Before(next.at) {
+			next = t
+		}
+	}
+	c.timers = active
+	return next
+}
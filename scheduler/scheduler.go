@@ -0,0 +1,189 @@
+package scheduler
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Clock は現在時刻とタイマーを提供する(テストでは任意の実装に差し替える)
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func RealClock() Clock {
+	return realClock{}
+}
+
+type job struct {
+	id    string
+	at    time.Time
+	fn    func()
+	index int
+}
+
+// jobHeap は実行時刻が早い順に並ぶ最小ヒープ
+type jobHeap []*job
+
+func (h jobHeap) Len() int           { return len(h) }
+func (h jobHeap) Less(a, b int) bool { return h[a].at.Before(h[b].at) }
+func (h jobHeap) Swap(a, b int) {
+	h[a], h[b] = h[b], h[a]
+	h[a].index = a
+	h[b].index = b
+}
+
+func (h *jobHeap) Push(x any) {
+	j := x.(*job)
+	j.index = len(*h)
+	*h = append(*h, j)
+}
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	j.index = -1
+	*h = old[:n-1]
+	return j
+}
+
+// Scheduler は登録された処理を指定時刻ちょうどに実行する
+type Scheduler struct {
+	mu      sync.Mutex
+	clock   Clock
+	jobs    jobHeap
+	index   map[string]*job
+	timer   Timer
+	started bool
+}
+
+func New(clock Clock) *Scheduler {
+	return &Scheduler{
+		clock: clock,
+		jobs:  make(jobHeap, 0),
+		index: make(map[string]*job),
+	}
+}
+
+// Start 以前に登録された処理は Start が呼ばれるまで実行されない
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.started = true
+	s.arm()
+}
+
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.started = false
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// 同じIDの処理が既にある場合は実行時刻と処理を置き換える
+func (s *Scheduler) Schedule(id string, at time.Time, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if j, exist := s.index[id]; exist {
+		j.at = at
+		j.fn = fn
+		heap.Fix(&s.jobs, j.index)
+	} else {
+		j := &job{
+			id: id,
+			at: at,
+			fn: fn,
+		}
+		heap.Push(&s.jobs, j)
+		s.index[id] = j
+	}
+	s.arm()
+}
+
+func (s *Scheduler) Cancel(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, exist := s.index[id]
+	if !exist {
+		return false
+	}
+	heap.Remove(&s.jobs, j.index)
+	delete(s.index, id)
+	s.arm()
+	return true
+}
+
+func (s *Scheduler) Scheduled(id string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, exist := s.index[id]
+	if !exist {
+		return time.Time{}, false
+	}
+	return j.at, true
+}
+
+// 最も早い処理の時刻にタイマーを合わせる(ロックを取った状態で呼ぶ)
+func (s *Scheduler) arm() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if !s.started || len(s.jobs) == 0 {
+		return
+	}
+
+	wait := s.jobs[0].at.Sub(s.clock.Now())
+	if wait < 0 {
+		wait = 0
+	}
+	s.timer = s.clock.AfterFunc(wait, s.fire)
+}
+
+func (s *Scheduler) fire() {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return
+	}
+
+	now := s.clock.Now()
+	due := make([]*job, 0)
+	for len(s.jobs) > 0 && !s.jobs[0].at.After(now) {
+		j := heap.Pop(&s.jobs).(*job)
+		delete(s.index, j.id)
+		due = append(due, j)
+	}
+	s.arm()
+	s.mu.Unlock()
+
+	//処理の中から Schedule や Cancel を呼べるようにロックの外で実行する
+	for _, j := range due {
+		j.fn()
+	}
+}
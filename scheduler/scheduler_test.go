@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var baseTime = time.Date(2026, 10, 25, 12, 0, 0, 0, time.UTC)
+
+// 実行された処理のIDを順に記録する
+type recorder struct {
+	ran []string
+}
+
+func (r *recorder) job(id string) func() {
+	return func() {
+		r.ran = append(r.ran, id)
+	}
+}
+
+func newStartedScheduler() (*Scheduler, *FakeClock, *recorder) {
+	clock := NewFakeClock(baseTime)
+	s := New(clock)
+	s.Start()
+	return s, clock, &recorder{}
+}
+
+func TestSchedulerRunsJobsInTimeOrder(t *testing.T) {
+	s, clock, r := newStartedScheduler()
+	s.Schedule("c", baseTime.Add(30*time.Minute), r.job("c"))
+	s.Schedule("a", baseTime.Add(10*time.Minute), r.job("a"))
+	s.Schedule("b", baseTime.Add(20*time.Minute), r.job("b"))
+
+	clock.Advance(15 * time.Minute)
+	if want := []string{"a"}; !reflect.DeepEqual(r.ran, want) {
+		t.Fatalf("after 15m ran %v, want %v", r.ran, want)
+	}
+
+	clock.Advance(time.Hour)
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(r.ran, want) {
+		t.Fatalf("after 1h15m ran %v, want %v", r.ran, want)
+	}
+	if _, exist := s.Scheduled("c"); exist {
+		t.Errorf("finished job is still scheduled")
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	s, clock, r := newStartedScheduler()
+	s.Schedule("a", baseTime.Add(10*time.Minute), r.job("a"))
+	s.Schedule("b", baseTime.Add(20*time.Minute), r.job("b"))
+
+	if !s.Cancel("a") {
+		t.Fatalf("Cancel(a) = false, want true")
+	}
+	if s.Cancel("a") {
+		t.Errorf("second Cancel(a) = true, want false")
+	}
+
+	clock.Advance(time.Hour)
+	if want := []string{"b"}; !reflect.DeepEqual(r.ran, want) {
+		t.Errorf("ran %v, want %v", r.ran, want)
+	}
+}
+
+func TestSchedulerReschedule(t *testing.T) {
+	s, clock, r := newStartedScheduler()
+	s.Schedule("a", baseTime.Add(10*time.Minute), r.job("a"))
+	s.Schedule("b", baseTime.Add(20*time.Minute), r.job("b"))
+	//同じIDで登録し直すと時刻と処理が置き換わる
+	s.Schedule("a", baseTime.Add(30*time.Minute), r.job("a2"))
+
+	if at, _ := s.Scheduled("a"); !at.Equal(baseTime.Add(30 * time.Minute)) {
+		t.Errorf("Scheduled(a) = %v, want %v", at, baseTime.Add(30*time.Minute))
+	}
+
+	clock.Advance(time.Hour)
+	if want := []string{"b", "a2"}; !reflect.DeepEqual(r.ran, want) {
+		t.Errorf("ran %v, want %v", r.ran, want)
+	}
+}
+
+func TestSchedulerRunsPastDueJobsOnStart(t *testing.T) {
+	clock := NewFakeClock(baseTime)
+	s := New(clock)
+	r := &recorder{}
+	s.Schedule("late", baseTime.Add(-time.Hour), r.job("late"))
+	s.Schedule("later", baseTime.Add(-time.Minute), r.job("later"))
+	s.Schedule("future", baseTime.Add(time.Hour), r.job("future"))
+
+	//Start 前は実行されない
+	clock.Advance(0)
+	if len(r.ran) != 0 {
+		t.Fatalf("ran %v before Start", r.ran)
+	}
+
+	s.Start()
+	clock.Advance(0)
+	if want := []string{"late", "later"}; !reflect.DeepEqual(r.ran, want) {
+		t.Errorf("ran %v, want %v", r.ran, want)
+	}
+}
+
+func TestSchedulerJobCanScheduleAnother(t *testing.T) {
+	s, clock, r := newStartedScheduler()
+	s.Schedule("first", baseTime.Add(time.Minute), func() {
+		r.ran = append(r.ran, "first")
+		s.Schedule("second", clock.Now().Add(time.Minute), r.job("second"))
+	})
+
+	clock.Advance(5 * time.Minute)
+	if want := []string{"first", "second"}; !reflect.DeepEqual(r.ran, want) {
+		t.Errorf("ran %v, want %v", r.ran, want)
+	}
+}
+
+func TestSchedulerStop(t *testing.T) {
+	s, clock, r := newStartedScheduler()
+	s.Schedule("a", baseTime.Add(time.Minute), r.job("a"))
+	s.Stop()
+
+	clock.Advance(time.Hour)
+	if len(r.ran) != 0 {
+		t.Errorf("ran %v after Stop", r.ran)
+	}
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"gemubobot/gemubo"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Snapshot はBotManagerが永続化する状態の全体
+type Snapshot struct {
+	Templates []*gemubo.Template
+	Presets   []*PresetRecord
+	BosyuMsgs []*gemubo.GemuboMessage
+	//開始・削除された募集
+	BosyuHistory []*gemubo.GemuboMessage
+	Schedules    []*gemubo.Schedule
+	//サーバーIDまたはユーザーIDごとのタイムゾーン名
+	GuildTimezones map[string]string
+	UserTimezones  map[string]string
+}
+
+// PresetRecord はプリセットを保存用に表したもの(テンプレートは名前で参照する)
+type PresetRecord struct {
+	GuildId         string
+	Name            string
+	TemplateGuildId string
+	TemplateName    string
+	Params          map[string]string
+}
+
+type Store interface {
+	Load() (*Snapshot, error)
+	Save(snapshot *Snapshot) error
+}
+
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		Templates:      make([]*gemubo.Template, 0),
+		Presets:        make([]*PresetRecord, 0),
+		BosyuMsgs:      make([]*gemubo.GemuboMessage, 0),
+		BosyuHistory:   make([]*gemubo.GemuboMessage, 0),
+		Schedules:      make([]*gemubo.Schedule, 0),
+		GuildTimezones: make(map[string]string),
+		UserTimezones:  make(map[string]string),
+	}
+}
+
+// FileStore は状態をJSONファイルに保存する
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{
+		path: path,
+	}
+}
+
+func (fs *FileStore) Load() (*Snapshot, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, err := os.ReadFile(fs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewSnapshot(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := NewSnapshot()
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (fs *FileStore) Save(snapshot *Snapshot) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	//書き込み途中で落ちてもファイルが壊れないように一時ファイルから置き換える
+	dir := filepath.Dir(fs.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(fs.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.path)
+}
+
+// MemoryStore はプロセス内にのみ状態を保持する(永続化しない場合用)
+type MemoryStore struct {
+	data []byte
+	mu   sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (ms *MemoryStore) Load() (*Snapshot, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	snapshot := NewSnapshot()
+	if ms.data == nil {
+		return snapshot, nil
+	}
+	if err := json.Unmarshal(ms.data, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (ms *MemoryStore) Save(snapshot *Snapshot) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	ms.data = data
+	return nil
+}